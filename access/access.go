@@ -0,0 +1,196 @@
+package access
+
+import (
+	"sort"
+	"sync"
+	"thumb-bot/infra/storage"
+)
+
+// State is the persisted form of the access lists.
+type State struct {
+	BannedUsers  []int64 `json:"banned_users,omitempty"`
+	BannedChats  []int64 `json:"banned_chats,omitempty"`
+	AllowedChats []int64 `json:"allowed_chats,omitempty"`
+	// AllowlistMode serves only AllowedChats when enabled.
+	AllowlistMode bool `json:"allowlist_mode"`
+}
+
+// Store persists the access lists.
+type Store interface {
+	Load() (State, error)
+	Save(State) error
+}
+
+// List decides which users and chats the bot serves. Changes are saved to
+// the store as they happen.
+type List struct {
+	mu    sync.RWMutex
+	store Store
+
+	bannedUsers   map[int64]struct{}
+	bannedChats   map[int64]struct{}
+	allowedChats  map[int64]struct{}
+	allowlistMode bool
+}
+
+// NewList loads the lists saved in store.
+func NewList(store Store) (*List, error) {
+	state, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+	return &List{
+		store:         store,
+		bannedUsers:   toSet(state.BannedUsers),
+		bannedChats:   toSet(state.BannedChats),
+		allowedChats:  toSet(state.AllowedChats),
+		allowlistMode: state.AllowlistMode,
+	}, nil
+}
+
+// Seed adds bannedUsers to the persisted list. It is applied on every
+// startup, so seeded users stay banned until removed from the seed too.
+func (l *List) Seed(bannedUsers []int64) error {
+	return l.update(func() {
+		for _, id := range bannedUsers {
+			l.bannedUsers[id] = struct{}{}
+		}
+	})
+}
+
+// UserBanned reports whether userID was banned.
+func (l *List) UserBanned(userID int64) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	_, banned := l.bannedUsers[userID]
+	return banned
+}
+
+// ChatServed reports whether the bot should answer in chatID.
+func (l *List) ChatServed(chatID int64) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if _, banned := l.bannedChats[chatID]; banned {
+		return false
+	}
+	if !l.allowlistMode {
+		return true
+	}
+	_, allowed := l.allowedChats[chatID]
+	return allowed
+}
+
+func (l *List) BanUser(userID int64) error {
+	return l.update(func() { l.bannedUsers[userID] = struct{}{} })
+}
+
+func (l *List) UnbanUser(userID int64) error {
+	return l.update(func() { delete(l.bannedUsers, userID) })
+}
+
+func (l *List) BanChat(chatID int64) error {
+	return l.update(func() { l.bannedChats[chatID] = struct{}{} })
+}
+
+func (l *List) UnbanChat(chatID int64) error {
+	return l.update(func() { delete(l.bannedChats, chatID) })
+}
+
+func (l *List) AllowChat(chatID int64) error {
+	return l.update(func() { l.allowedChats[chatID] = struct{}{} })
+}
+
+func (l *List) DisallowChat(chatID int64) error {
+	return l.update(func() { delete(l.allowedChats, chatID) })
+}
+
+func (l *List) SetAllowlistMode(enabled bool) error {
+	return l.update(func() { l.allowlistMode = enabled })
+}
+
+// Snapshot returns the current lists.
+func (l *List) Snapshot() State {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.state()
+}
+
+func (l *List) update(change func()) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	change()
+	return l.store.Save(l.state())
+}
+
+func (l *List) state() State {
+	return State{
+		BannedUsers:   fromSet(l.bannedUsers),
+		BannedChats:   fromSet(l.bannedChats),
+		AllowedChats:  fromSet(l.allowedChats),
+		AllowlistMode: l.allowlistMode,
+	}
+}
+
+func toSet(ids []int64) map[int64]struct{} {
+	set := make(map[int64]struct{}, len(ids))
+	for _, id := range ids {
+		set[id] = struct{}{}
+	}
+	return set
+}
+
+func fromSet(set map[int64]struct{}) []int64 {
+	ids := make([]int64, 0, len(set))
+	for id := range set {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+const (
+	bucket   = "access"
+	stateKey = "state"
+)
+
+// BoltStore keeps the lists in the embedded database.
+type BoltStore struct {
+	db *storage.DB
+}
+
+func NewBoltStore(db *storage.DB) *BoltStore {
+	return &BoltStore{db: db}
+}
+
+func (s *BoltStore) Load() (State, error) {
+	var state State
+	_, err := s.db.Get(bucket, stateKey, &state)
+	return state, err
+}
+
+func (s *BoltStore) Save(state State) error {
+	return s.db.Put(bucket, stateKey, state)
+}
+
+// MemoryStore keeps the lists for the lifetime of the process only.
+type MemoryStore struct {
+	mu    sync.Mutex
+	state State
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func (s *MemoryStore) Load() (State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state, nil
+}
+
+func (s *MemoryStore) Save(state State) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = state
+	return nil
+}
@@ -0,0 +1,50 @@
+// Package admin serves the operator endpoints, guarded by a bearer token.
+package admin
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"github.com/gofiber/adaptor/v2"
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// LogLevelPath reads the log level on GET and changes it on PUT with a body
+// such as {"level":"debug"}.
+const LogLevelPath = "/admin/log-level"
+
+// Register mounts the admin endpoints on app. Nothing is mounted when token
+// is empty, so the endpoints are never left open.
+func Register(app *fiber.App, logger *zap.Logger, token string, level zap.AtomicLevel) {
+	if token == "" {
+		return
+	}
+
+	levelHandler := adaptor.HTTPHandler(level)
+	app.All(LogLevelPath, authorize(logger, token), func(c *fiber.Ctx) error {
+		before := level.Level()
+		if err := levelHandler(c); err != nil {
+			return err
+		}
+		if after := level.Level(); after != before {
+			logger.Warn("log level changed", zap.Stringer("from", before), zap.Stringer("to", after), zap.String("ip", c.IP()))
+		}
+		return nil
+	})
+}
+
+// authorize rejects requests without an "Authorization: Bearer <token>"
+// header matching token.
+func authorize(logger *zap.Logger, token string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		got, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			logger.Warn("rejected admin request", zap.String("path", c.Path()), zap.String("ip", c.IP()))
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid admin token",
+			})
+		}
+		return c.Next()
+	}
+}
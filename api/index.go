@@ -1,9 +1,14 @@
 package handler
 
 import (
+	"context"
 	"net/http"
 	"os"
+	"sync"
+	"thumb-bot/config"
 	"thumb-bot/infra/logs"
+	"thumb-bot/infra/metrics"
+	"thumb-bot/infra/tracing"
 	"thumb-bot/service"
 	"thumb-bot/webhook"
 
@@ -11,6 +16,7 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/mymmrac/telego"
+	"github.com/mymmrac/telego/telegoapi"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -18,30 +24,59 @@ import (
 var (
 	app *fiber.App
 	bot *telego.Bot
+
+	// The handler is built once per instance, so the settings, access
+	// lists, dedup store and rate limits kept in memory last between
+	// requests served by the same instance
+	build       sync.Once
+	httpHandler http.HandlerFunc
 )
 
 func handler() http.HandlerFunc {
+	// Load configuration from the environment
+	cfg, err := config.Load(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		logger, _ := logs.NewLogger(logs.Config{Level: zapcore.InfoLevel})
+		logger.Fatal("invalid configuration", zap.Error(err))
+	}
+
 	// Initialize logger
-	logger := logs.NewLogger(zapcore.InfoLevel)
+	// The level is not exposed here: the admin endpoints are not served
+	logger, _ := logs.NewLogger(cfg.Logging())
+	for _, warning := range cfg.Warnings {
+		logger.Warn(warning)
+	}
 
-	// Get bot token from environment variable
-	token := os.Getenv("TELEGRAM_TOKEN")
-	if token == "" {
-		logger.Fatal("TELEGRAM_TOKEN environment variable is not set")
+	// Export traces when an OTLP endpoint is configured
+	if _, err := tracing.Setup(context.Background(), tracing.Config(cfg.Tracing)); err != nil {
+		logger.Error("failed to set up tracing", zap.Error(err))
 	}
 
 	// Initialize bot with token
-	var err error
-	bot, err = telego.NewBot(token)
+	bot, err = telego.NewBot(cfg.TelegramToken, telego.WithAPICaller(metrics.NewTelegramCaller(telegoapi.DefaultFastHTTPCaller)))
 	if err != nil {
 		logger.Fatal("failed to create bot", zap.Error(err))
 	}
 
 	// Create service
-	telegramService := service.NewTelegramService(logger, bot)
+	telegramService := service.NewTelegramService(logger, bot, cfg)
+
+	// Register the webhook when the public URL is known
+	webhookSecret := cfg.Webhook.Secret
+	if cfg.Webhook.URL != "" {
+		err := webhook.Register(bot, webhook.Config{
+			URL:            cfg.Webhook.URL,
+			SecretToken:    webhookSecret,
+			MaxConnections: cfg.Webhook.MaxConnections,
+			AllowedUpdates: []string{"message"},
+		})
+		if err != nil {
+			logger.Error("failed to register webhook", zap.Error(err))
+		}
+	}
 
 	// Create webhook handler
-	webhookHandler := webhook.NewWebhookHandler(logger, bot, telegramService)
+	webhookHandler := webhook.NewWebhookHandler(logger, bot, telegramService, webhookSecret)
 
 	// Create Fiber app
 	app = fiber.New(fiber.Config{
@@ -58,8 +93,12 @@ func handler() http.HandlerFunc {
 		})
 	})
 
+	// Prometheus metrics endpoint
+	metrics.RegisterProviderCache(telegramService.CacheStats)
+	app.Get("/metrics", adaptor.HTTPHandler(metrics.Handler()))
+
 	// Webhook endpoint
-	app.Post("/webhook", webhookHandler.HandleWebhook)
+	app.Post(webhook.Path, webhookHandler.HandleWebhook)
 
 	return adaptor.FiberApp(app)
 }
@@ -67,5 +106,6 @@ func handler() http.HandlerFunc {
 // Handler is the main function that Vercel will call
 func Handler(w http.ResponseWriter, r *http.Request) {
 	r.RequestURI = r.URL.String()
-	handler().ServeHTTP(w, r)
+	build.Do(func() { httpHandler = handler() })
+	httpHandler.ServeHTTP(w, r)
 }
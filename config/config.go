@@ -0,0 +1,450 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"thumb-bot/infra/logs"
+	"thumb-bot/infra/queue"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultPath is read when no config file is given and it exists.
+const DefaultPath = "config/config.json"
+
+const (
+	RunModePolling = "polling"
+	RunModeWebhook = "webhook"
+	// RunModeNone receives no updates, e.g. when running tests against the HTTP endpoints.
+	RunModeNone = "none"
+)
+
+// Config is the bot configuration. Values are read from the config file and
+// then overridden by environment variables.
+type Config struct {
+	TelegramToken string `json:"telegram_token" yaml:"telegram_token"`
+	LogLevel      string `json:"log_level" yaml:"log_level"`
+	// LogEncoding is json or console.
+	LogEncoding string      `json:"log_encoding" yaml:"log_encoding"`
+	LogSampling LogSampling `json:"log_sampling" yaml:"log_sampling"`
+	RunMode     string      `json:"run_mode" yaml:"run_mode"`
+	ListenAddr  string      `json:"listen_addr" yaml:"listen_addr"`
+	DBPath      string      `json:"db_path" yaml:"db_path"`
+
+	OwnerIDs      []int64 `json:"owner_ids" yaml:"owner_ids"`
+	UserBlacklist []int64 `json:"user_blacklist" yaml:"user_blacklist"`
+
+	// Providers toggles providers by name; missing providers are enabled.
+	Providers map[string]bool `json:"providers" yaml:"providers"`
+
+	Webhook    Webhook    `json:"webhook" yaml:"webhook"`
+	Queue      Queue      `json:"queue" yaml:"queue"`
+	HTTP       HTTP       `json:"http" yaml:"http"`
+	HTTPClient HTTPClient `json:"http_client" yaml:"http_client"`
+	Instagram  Instagram  `json:"instagram" yaml:"instagram"`
+	Limits     Limits     `json:"limits" yaml:"limits"`
+	Dedup      Dedup      `json:"dedup" yaml:"dedup"`
+	FileCache  FileCache  `json:"file_cache" yaml:"file_cache"`
+
+	ProviderCache ProviderCache `json:"provider_cache" yaml:"provider_cache"`
+
+	RateLimit RateLimit `json:"rate_limit" yaml:"rate_limit"`
+	Breaker   Breaker   `json:"breaker" yaml:"breaker"`
+	Tracing   Tracing   `json:"tracing" yaml:"tracing"`
+	Admin     Admin     `json:"admin" yaml:"admin"`
+
+	// Warnings lists the values Load skipped instead of failing, for the
+	// caller to log once it has a logger.
+	Warnings []string `json:"-" yaml:"-"`
+}
+
+// LogSampling keeps, per message and second, the first Initial debug and info
+// lines and every Thereafter-th after that; zero Initial disables sampling.
+type LogSampling struct {
+	Initial    int `json:"initial" yaml:"initial"`
+	Thereafter int `json:"thereafter" yaml:"thereafter"`
+}
+
+// Admin protects the admin endpoints with a bearer token; they are off when
+// Token is empty.
+type Admin struct {
+	Token string `json:"token" yaml:"token"`
+}
+
+type Webhook struct {
+	URL            string `json:"url" yaml:"url"`
+	Secret         string `json:"secret" yaml:"secret"`
+	MaxConnections int    `json:"max_connections" yaml:"max_connections"`
+}
+
+type Queue struct {
+	Workers      int      `json:"workers" yaml:"workers"`
+	Size         int      `json:"size" yaml:"size"`
+	Overflow     string   `json:"overflow" yaml:"overflow"`
+	BlockTimeout Duration `json:"block_timeout" yaml:"block_timeout"`
+}
+
+// HTTP holds the timeouts of the bot's HTTP server.
+type HTTP struct {
+	ReadTimeout  Duration `json:"read_timeout" yaml:"read_timeout"`
+	WriteTimeout Duration `json:"write_timeout" yaml:"write_timeout"`
+	IdleTimeout  Duration `json:"idle_timeout" yaml:"idle_timeout"`
+}
+
+// HTTPClient configures the requests the integrations make.
+type HTTPClient struct {
+	Timeout   Duration `json:"timeout" yaml:"timeout"`
+	UserAgent string   `json:"user_agent" yaml:"user_agent"`
+	// Proxy is the URL of an outbound proxy; the standard HTTP_PROXY and
+	// HTTPS_PROXY variables apply when empty.
+	Proxy        string `json:"proxy" yaml:"proxy"`
+	MaxBodyBytes int64  `json:"max_body_bytes" yaml:"max_body_bytes"`
+}
+
+// Instagram configures the retries of the Instagram GraphQL request.
+type Instagram struct {
+	Retries  int      `json:"retries" yaml:"retries"`
+	Delay    Duration `json:"delay" yaml:"delay"`
+	MaxDelay Duration `json:"max_delay" yaml:"max_delay"`
+}
+
+type Limits struct {
+	MaxLinksPerMessage int `json:"max_links_per_message" yaml:"max_links_per_message"`
+	// MaxMediaBytes is the largest video variant sent to Telegram.
+	MaxMediaBytes int64 `json:"max_media_bytes" yaml:"max_media_bytes"`
+	// MaxUploadBytes bounds the files the bot downloads and uploads itself
+	// when Telegram cannot fetch a URL.
+	MaxUploadBytes int64    `json:"max_upload_bytes" yaml:"max_upload_bytes"`
+	UploadTimeout  Duration `json:"upload_timeout" yaml:"upload_timeout"`
+	// UpdateTimeout bounds the fetches and uploads made for one update.
+	UpdateTimeout Duration `json:"update_timeout" yaml:"update_timeout"`
+}
+
+type Dedup struct {
+	TTL Duration `json:"ttl" yaml:"ttl"`
+}
+
+// FileCache bounds the cache of Telegram file_ids of sent posts.
+type FileCache struct {
+	TTL        Duration `json:"ttl" yaml:"ttl"`
+	MaxEntries int      `json:"max_entries" yaml:"max_entries"`
+	// Persistent keeps the cache in the database instead of memory.
+	Persistent bool `json:"persistent" yaml:"persistent"`
+}
+
+// ProviderCache bounds the cache of provider responses. NegativeTTL applies
+// to posts that were not found or are private.
+type ProviderCache struct {
+	TTL         Duration `json:"ttl" yaml:"ttl"`
+	NegativeTTL Duration `json:"negative_ttl" yaml:"negative_ttl"`
+	MaxEntries  int      `json:"max_entries" yaml:"max_entries"`
+}
+
+// RateLimit holds the token buckets applied per sender and per chat to the
+// links handled, per host to the requests made upstream and per chat to the
+// replies explaining failed links.
+type RateLimit struct {
+	User         Rate `json:"user" yaml:"user"`
+	Chat         Rate `json:"chat" yaml:"chat"`
+	Host         Rate `json:"host" yaml:"host"`
+	ErrorReplies Rate `json:"error_replies" yaml:"error_replies"`
+}
+
+// Rate refills PerMinute tokens a minute up to Burst; a zero PerMinute
+// disables the limit.
+type Rate struct {
+	PerMinute float64 `json:"per_minute" yaml:"per_minute"`
+	Burst     int     `json:"burst" yaml:"burst"`
+}
+
+// Breaker pauses a provider for Cooldown after Failures consecutive upstream
+// failures; zero Failures disables it.
+type Breaker struct {
+	Failures int      `json:"failures" yaml:"failures"`
+	Cooldown Duration `json:"cooldown" yaml:"cooldown"`
+}
+
+// Tracing exports spans over OTLP/HTTP to Endpoint, a URL such as
+// http://localhost:4318; an empty Endpoint disables tracing.
+type Tracing struct {
+	Endpoint    string `json:"endpoint" yaml:"endpoint"`
+	ServiceName string `json:"service_name" yaml:"service_name"`
+	// SampleRatio is the share of updates traced, from 0 to 1.
+	SampleRatio float64 `json:"sample_ratio" yaml:"sample_ratio"`
+}
+
+// Default returns the configuration used for everything left unset.
+func Default() Config {
+	return Config{
+		LogLevel:    "info",
+		LogEncoding: "json",
+		RunMode:     RunModePolling,
+		ListenAddr:  ":3000",
+		DBPath:      "data/thumb-bot.db",
+		Queue: Queue{
+			Workers:      4,
+			Size:         100,
+			Overflow:     string(queue.OverflowReject),
+			BlockTimeout: Duration(5 * time.Second),
+		},
+		HTTP: HTTP{
+			ReadTimeout:  Duration(10 * time.Second),
+			WriteTimeout: Duration(10 * time.Second),
+			IdleTimeout:  Duration(60 * time.Second),
+		},
+		HTTPClient: HTTPClient{
+			Timeout:      Duration(30 * time.Second),
+			UserAgent:    "thumb-bot/1.0 (+https://github.com/victormlourenco/thumb-bot)",
+			MaxBodyBytes: 10 * 1024 * 1024,
+		},
+		Instagram: Instagram{
+			Retries:  5,
+			Delay:    Duration(time.Second),
+			MaxDelay: Duration(30 * time.Second),
+		},
+		Limits: Limits{
+			MaxLinksPerMessage: 5,
+			MaxMediaBytes:      20 * 1024 * 1024,
+			MaxUploadBytes:     50 * 1024 * 1024,
+			UploadTimeout:      Duration(60 * time.Second),
+			UpdateTimeout:      Duration(2 * time.Minute),
+		},
+		Dedup: Dedup{
+			TTL: Duration(10 * time.Minute),
+		},
+		FileCache: FileCache{
+			TTL:        Duration(24 * time.Hour),
+			MaxEntries: 1000,
+		},
+		ProviderCache: ProviderCache{
+			TTL:         Duration(10 * time.Minute),
+			NegativeTTL: Duration(time.Minute),
+			MaxEntries:  1000,
+		},
+		RateLimit: RateLimit{
+			User:         Rate{PerMinute: 10, Burst: 5},
+			Chat:         Rate{PerMinute: 30, Burst: 10},
+			Host:         Rate{PerMinute: 60, Burst: 10},
+			ErrorReplies: Rate{PerMinute: 1, Burst: 3},
+		},
+		Breaker: Breaker{
+			Failures: 5,
+			Cooldown: Duration(time.Minute),
+		},
+		Tracing: Tracing{
+			ServiceName: "thumb-bot",
+			SampleRatio: 1,
+		},
+	}
+}
+
+// Load reads the config file at path (JSON or YAML, by extension), applies
+// environment overrides and validates the result. An empty path reads
+// DefaultPath if it exists.
+func Load(path string) (Config, error) {
+	cfg := Default()
+
+	if path == "" {
+		if _, err := os.Stat(DefaultPath); err == nil {
+			path = DefaultPath
+		}
+	}
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return Config{}, err
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return Config{}, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		err = json.Unmarshal(raw, c)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(raw, c)
+	default:
+		return fmt.Errorf("unsupported config file extension %q, expected .json, .yaml or .yml", ext)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate reports every invalid setting at once.
+func (c Config) Validate() error {
+	var errs []error
+	add := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if c.TelegramToken == "" {
+		add("telegram_token is required (or set TELEGRAM_TOKEN)")
+	}
+	if _, err := zapcore.ParseLevel(c.LogLevel); err != nil {
+		add("log_level: %v", err)
+	}
+	switch c.LogEncoding {
+	case "json", "console":
+	default:
+		add("log_encoding must be json or console, got %q", c.LogEncoding)
+	}
+	if c.LogSampling.Initial < 0 || c.LogSampling.Thereafter < 0 {
+		add("log_sampling must not be negative")
+	}
+	switch c.RunMode {
+	case RunModePolling, RunModeWebhook, RunModeNone:
+	default:
+		add("run_mode: unknown run mode %q, expected polling, webhook or none", c.RunMode)
+	}
+	if c.ListenAddr == "" {
+		add("listen_addr is required")
+	}
+
+	if c.RunMode == RunModeWebhook && c.Webhook.URL == "" {
+		add("webhook.url is required in webhook mode (or set WEBHOOK_URL)")
+	}
+	if n := c.Webhook.MaxConnections; n != 0 && (n < 1 || n > 100) {
+		add("webhook.max_connections must be between 1 and 100, got %d", n)
+	}
+
+	if c.Queue.Workers < 1 {
+		add("queue.workers must be at least 1, got %d", c.Queue.Workers)
+	}
+	if c.Queue.Size < 0 {
+		add("queue.size must not be negative, got %d", c.Queue.Size)
+	}
+	if _, err := queue.ParseOverflowPolicy(c.Queue.Overflow); err != nil {
+		add("queue.overflow: %v", err)
+	}
+
+	if c.HTTPClient.Timeout <= 0 {
+		add("http_client.timeout must be positive")
+	}
+	if c.HTTPClient.Proxy != "" {
+		if u, err := url.Parse(c.HTTPClient.Proxy); err != nil || u.Scheme == "" || u.Host == "" {
+			add("http_client.proxy must be an absolute URL such as http://proxy:3128, got %q", c.HTTPClient.Proxy)
+		}
+	}
+	if c.HTTPClient.MaxBodyBytes < 0 {
+		add("http_client.max_body_bytes must not be negative, got %d", c.HTTPClient.MaxBodyBytes)
+	}
+
+	if c.Instagram.Retries < 0 {
+		add("instagram.retries must not be negative, got %d", c.Instagram.Retries)
+	}
+	if c.Instagram.Delay <= 0 {
+		add("instagram.delay must be positive")
+	}
+	if c.Instagram.MaxDelay < c.Instagram.Delay {
+		add("instagram.max_delay must not be lower than instagram.delay")
+	}
+
+	if c.Limits.MaxLinksPerMessage < 1 {
+		add("limits.max_links_per_message must be at least 1, got %d", c.Limits.MaxLinksPerMessage)
+	}
+	if c.Limits.MaxMediaBytes < 1 {
+		add("limits.max_media_bytes must be positive, got %d", c.Limits.MaxMediaBytes)
+	}
+	if c.Limits.MaxUploadBytes < 1 {
+		add("limits.max_upload_bytes must be positive, got %d", c.Limits.MaxUploadBytes)
+	}
+	if c.Limits.UploadTimeout <= 0 {
+		add("limits.upload_timeout must be positive")
+	}
+	if c.Limits.UpdateTimeout <= 0 {
+		add("limits.update_timeout must be positive")
+	}
+	if c.Dedup.TTL <= 0 {
+		add("dedup.ttl must be positive")
+	}
+	if c.FileCache.TTL <= 0 {
+		add("file_cache.ttl must be positive")
+	}
+	if c.FileCache.MaxEntries < 1 {
+		add("file_cache.max_entries must be at least 1, got %d", c.FileCache.MaxEntries)
+	}
+	if c.ProviderCache.TTL < 0 || c.ProviderCache.NegativeTTL < 0 {
+		add("provider_cache.ttl and provider_cache.negative_ttl must not be negative")
+	}
+	if c.ProviderCache.MaxEntries < 1 {
+		add("provider_cache.max_entries must be at least 1, got %d", c.ProviderCache.MaxEntries)
+	}
+
+	rates := []struct {
+		name string
+		Rate
+	}{{"user", c.RateLimit.User}, {"chat", c.RateLimit.Chat}, {"host", c.RateLimit.Host}, {"error_replies", c.RateLimit.ErrorReplies}}
+	for _, rate := range rates {
+		if rate.PerMinute < 0 || rate.Burst < 0 {
+			add("rate_limit.%s must not be negative", rate.name)
+		}
+	}
+	if c.Breaker.Failures < 0 {
+		add("breaker.failures must not be negative, got %d", c.Breaker.Failures)
+	}
+	if c.Breaker.Failures > 0 && c.Breaker.Cooldown <= 0 {
+		add("breaker.cooldown must be positive")
+	}
+	if c.Tracing.Endpoint != "" {
+		if u, err := url.Parse(c.Tracing.Endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+			add("tracing.endpoint must be a URL such as http://localhost:4318, got %q", c.Tracing.Endpoint)
+		}
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		add("tracing.sample_ratio must be between 0 and 1, got %g", c.Tracing.SampleRatio)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Level returns the parsed log level; Validate guarantees it parses.
+func (c Config) Level() zapcore.Level {
+	level, _ := zapcore.ParseLevel(c.LogLevel)
+	return level
+}
+
+// Logging returns the logger configuration.
+func (c Config) Logging() logs.Config {
+	return logs.Config{
+		Level:    c.Level(),
+		Encoding: c.LogEncoding,
+		Sampling: logs.Sampling(c.LogSampling),
+	}
+}
+
+// DisabledProviders lists the providers toggled off.
+func (c Config) DisabledProviders() []string {
+	var disabled []string
+	for name, enabled := range c.Providers {
+		if !enabled {
+			disabled = append(disabled, name)
+		}
+	}
+	sort.Strings(disabled)
+	return disabled
+}
@@ -0,0 +1,224 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// applyEnv overrides the configuration with the environment variables that
+// are set.
+func (c *Config) applyEnv() error {
+	var errs []error
+	collect := func(err error) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	envString("TELEGRAM_TOKEN", &c.TelegramToken)
+	envString("LOG_LEVEL", &c.LogLevel)
+	envString("LOG_ENCODING", &c.LogEncoding)
+	collect(envInt("LOG_SAMPLING_INITIAL", &c.LogSampling.Initial))
+	collect(envInt("LOG_SAMPLING_THEREAFTER", &c.LogSampling.Thereafter))
+	envString("RUN_MODE", &c.RunMode)
+	c.RunMode = strings.ToLower(strings.TrimSpace(c.RunMode))
+	envString("LISTEN_ADDR", &c.ListenAddr)
+	envString("DB_PATH", &c.DBPath)
+	collect(envIDs("TELEGRAM_OWNER_IDS", &c.OwnerIDs))
+	// Invalid blacklist entries have always been skipped with a warning
+	c.Warnings = append(c.Warnings, envIDsSkipInvalid("TELEGRAM_USER_BLACKLIST", &c.UserBlacklist)...)
+
+	if raw, ok := lookup("DISABLED_PROVIDERS"); ok {
+		if c.Providers == nil {
+			c.Providers = make(map[string]bool)
+		}
+		for _, name := range strings.Split(raw, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				c.Providers[name] = false
+			}
+		}
+	}
+
+	envString("WEBHOOK_URL", &c.Webhook.URL)
+	envString("WEBHOOK_SECRET", &c.Webhook.Secret)
+	collect(envInt("WEBHOOK_MAX_CONNECTIONS", &c.Webhook.MaxConnections))
+
+	collect(envInt("QUEUE_WORKERS", &c.Queue.Workers))
+	collect(envInt("QUEUE_SIZE", &c.Queue.Size))
+	envString("QUEUE_OVERFLOW", &c.Queue.Overflow)
+	collect(envDuration("QUEUE_BLOCK_TIMEOUT", &c.Queue.BlockTimeout))
+
+	collect(envDuration("HTTP_READ_TIMEOUT", &c.HTTP.ReadTimeout))
+	collect(envDuration("HTTP_WRITE_TIMEOUT", &c.HTTP.WriteTimeout))
+	collect(envDuration("HTTP_IDLE_TIMEOUT", &c.HTTP.IdleTimeout))
+
+	collect(envDuration("HTTP_CLIENT_TIMEOUT", &c.HTTPClient.Timeout))
+	envString("HTTP_CLIENT_USER_AGENT", &c.HTTPClient.UserAgent)
+	envString("OUTBOUND_PROXY", &c.HTTPClient.Proxy)
+	collect(envInt64("HTTP_CLIENT_MAX_BODY_BYTES", &c.HTTPClient.MaxBodyBytes))
+
+	collect(envInt("INSTAGRAM_RETRIES", &c.Instagram.Retries))
+	collect(envDuration("INSTAGRAM_RETRY_DELAY", &c.Instagram.Delay))
+	collect(envDuration("INSTAGRAM_MAX_RETRY_DELAY", &c.Instagram.MaxDelay))
+
+	collect(envInt("MAX_LINKS_PER_MESSAGE", &c.Limits.MaxLinksPerMessage))
+	collect(envInt64("MAX_MEDIA_BYTES", &c.Limits.MaxMediaBytes))
+	collect(envInt64("MAX_UPLOAD_BYTES", &c.Limits.MaxUploadBytes))
+	collect(envDuration("UPLOAD_TIMEOUT", &c.Limits.UploadTimeout))
+	collect(envDuration("UPDATE_TIMEOUT", &c.Limits.UpdateTimeout))
+	collect(envDuration("DEDUP_TTL", &c.Dedup.TTL))
+	collect(envDuration("FILE_CACHE_TTL", &c.FileCache.TTL))
+	collect(envInt("FILE_CACHE_MAX_ENTRIES", &c.FileCache.MaxEntries))
+	collect(envBool("FILE_CACHE_PERSISTENT", &c.FileCache.Persistent))
+	collect(envDuration("PROVIDER_CACHE_TTL", &c.ProviderCache.TTL))
+	collect(envDuration("PROVIDER_CACHE_NEGATIVE_TTL", &c.ProviderCache.NegativeTTL))
+	collect(envInt("PROVIDER_CACHE_MAX_ENTRIES", &c.ProviderCache.MaxEntries))
+
+	collect(envFloat("RATE_LIMIT_USER_PER_MINUTE", &c.RateLimit.User.PerMinute))
+	collect(envInt("RATE_LIMIT_USER_BURST", &c.RateLimit.User.Burst))
+	collect(envFloat("RATE_LIMIT_CHAT_PER_MINUTE", &c.RateLimit.Chat.PerMinute))
+	collect(envInt("RATE_LIMIT_CHAT_BURST", &c.RateLimit.Chat.Burst))
+	collect(envFloat("RATE_LIMIT_HOST_PER_MINUTE", &c.RateLimit.Host.PerMinute))
+	collect(envInt("RATE_LIMIT_HOST_BURST", &c.RateLimit.Host.Burst))
+	collect(envFloat("RATE_LIMIT_ERROR_REPLIES_PER_MINUTE", &c.RateLimit.ErrorReplies.PerMinute))
+	collect(envInt("RATE_LIMIT_ERROR_REPLIES_BURST", &c.RateLimit.ErrorReplies.Burst))
+	collect(envInt("BREAKER_FAILURES", &c.Breaker.Failures))
+	collect(envDuration("BREAKER_COOLDOWN", &c.Breaker.Cooldown))
+	envString("OTEL_EXPORTER_OTLP_ENDPOINT", &c.Tracing.Endpoint)
+	envString("OTEL_SERVICE_NAME", &c.Tracing.ServiceName)
+	collect(envFloat("TRACING_SAMPLE_RATIO", &c.Tracing.SampleRatio))
+	envString("ADMIN_TOKEN", &c.Admin.Token)
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid environment: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+func lookup(name string) (string, bool) {
+	raw, ok := os.LookupEnv(name)
+	raw = strings.TrimSpace(raw)
+	return raw, ok && raw != ""
+}
+
+func envString(name string, dst *string) {
+	if raw, ok := lookup(name); ok {
+		*dst = raw
+	}
+}
+
+func envInt(name string, dst *int) error {
+	raw, ok := lookup(name)
+	if !ok {
+		return nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		return fmt.Errorf("%s: %q is not an integer", name, raw)
+	}
+	*dst = n
+	return nil
+}
+
+func envInt64(name string, dst *int64) error {
+	raw, ok := lookup(name)
+	if !ok {
+		return nil
+	}
+	n, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%s: %q is not an integer", name, raw)
+	}
+	*dst = n
+	return nil
+}
+
+func envFloat(name string, dst *float64) error {
+	raw, ok := lookup(name)
+	if !ok {
+		return nil
+	}
+	f, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return fmt.Errorf("%s: %q is not a number", name, raw)
+	}
+	*dst = f
+	return nil
+}
+
+func envBool(name string, dst *bool) error {
+	raw, ok := lookup(name)
+	if !ok {
+		return nil
+	}
+	b, err := strconv.ParseBool(raw)
+	if err != nil {
+		return fmt.Errorf("%s: %q is not a boolean", name, raw)
+	}
+	*dst = b
+	return nil
+}
+
+func envDuration(name string, dst *Duration) error {
+	raw, ok := lookup(name)
+	if !ok {
+		return nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		return fmt.Errorf("%s: %q is not a duration such as \"30s\"", name, raw)
+	}
+	*dst = Duration(d)
+	return nil
+}
+
+// envIDs reads a comma separated list of Telegram IDs.
+func envIDs(name string, dst *[]int64) error {
+	raw, ok := lookup(name)
+	if !ok {
+		return nil
+	}
+	var ids []int64
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s: invalid id %q", name, part)
+		}
+		ids = append(ids, id)
+	}
+	*dst = ids
+	return nil
+}
+
+// envIDsSkipInvalid is envIDs keeping the valid IDs of a list with invalid
+// ones, which are returned as warnings.
+func envIDsSkipInvalid(name string, dst *[]int64) []string {
+	raw, ok := lookup(name)
+	if !ok {
+		return nil
+	}
+	var ids []int64
+	var warnings []string
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("%s: skipping invalid id %q", name, part))
+			continue
+		}
+		ids = append(ids, id)
+	}
+	*dst = ids
+	return warnings
+}
@@ -0,0 +1,259 @@
+package filecache
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/binary"
+	"encoding/json"
+	"sync"
+	"thumb-bot/infra/storage"
+	"thumb-bot/model"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Store remembers posts already sent to Telegram, their media replaced by
+// file_ids, so the next request for the same post skips the provider and the
+// download. Keys are canonical post URLs.
+type Store interface {
+	// Get returns the post stored under key unless it expired.
+	Get(key string) (model.Post, bool, error)
+	Put(key string, post model.Post) error
+}
+
+type entry struct {
+	Post     model.Post `json:"post"`
+	StoredAt time.Time  `json:"stored_at"`
+	// Seq is the key of the entry in the order bucket of a BoltStore.
+	Seq uint64 `json:"seq,omitempty"`
+}
+
+// MemoryStore keeps the maxEntries most recently used posts for ttl.
+type MemoryStore struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	order      *list.List
+	entries    map[string]*list.Element
+	now        func() time.Time
+}
+
+type memoryItem struct {
+	key   string
+	entry entry
+}
+
+func NewMemoryStore(ttl time.Duration, maxEntries int) *MemoryStore {
+	return &MemoryStore{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+		now:        time.Now,
+	}
+}
+
+func (s *MemoryStore) Get(key string) (model.Post, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.entries[key]
+	if !ok {
+		return model.Post{}, false, nil
+	}
+	item := elem.Value.(*memoryItem)
+	if s.now().Sub(item.entry.StoredAt) > s.ttl {
+		s.order.Remove(elem)
+		delete(s.entries, key)
+		return model.Post{}, false, nil
+	}
+	s.order.MoveToFront(elem)
+	return item.entry.Post, true, nil
+}
+
+func (s *MemoryStore) Put(key string, post model.Post) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item := &memoryItem{key: key, entry: entry{Post: post, StoredAt: s.now()}}
+	if elem, ok := s.entries[key]; ok {
+		elem.Value = item
+		s.order.MoveToFront(elem)
+		return nil
+	}
+	s.entries[key] = s.order.PushFront(item)
+
+	for s.order.Len() > s.maxEntries {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*memoryItem).key)
+	}
+	return nil
+}
+
+var (
+	bucket = []byte("file_ids")
+	// orderBucket lists the keys of bucket by insertion sequence, oldest
+	// first, so eviction does not scan the entries.
+	orderBucket = []byte("file_ids_order")
+	metaBucket  = []byte("file_ids_meta")
+	countKey    = []byte("count")
+)
+
+// BoltStore keeps posts in the embedded database so file_ids survive
+// restarts. Once over maxEntries the oldest posts are evicted.
+type BoltStore struct {
+	db         *storage.DB
+	ttl        time.Duration
+	maxEntries int
+	now        func() time.Time
+}
+
+func NewBoltStore(db *storage.DB, ttl time.Duration, maxEntries int) *BoltStore {
+	return &BoltStore{db: db, ttl: ttl, maxEntries: maxEntries, now: time.Now}
+}
+
+func (s *BoltStore) Get(key string) (model.Post, bool, error) {
+	var e entry
+	found, err := s.db.Get(string(bucket), key, &e)
+	if err != nil || !found {
+		return model.Post{}, false, err
+	}
+	if s.now().Sub(e.StoredAt) > s.ttl {
+		return model.Post{}, false, s.db.Update(func(tx *bolt.Tx) error {
+			b, err := openBuckets(tx)
+			if err != nil {
+				return err
+			}
+			return b.remove([]byte(key))
+		})
+	}
+	return e.Post, true, nil
+}
+
+func (s *BoltStore) Put(key string, post model.Post) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := openBuckets(tx)
+		if err != nil {
+			return err
+		}
+		if err := b.remove([]byte(key)); err != nil {
+			return err
+		}
+
+		seq, err := b.order.NextSequence()
+		if err != nil {
+			return err
+		}
+		raw, err := json.Marshal(entry{Post: post, StoredAt: s.now(), Seq: seq})
+		if err != nil {
+			return err
+		}
+		if err := b.entries.Put([]byte(key), raw); err != nil {
+			return err
+		}
+		if err := b.order.Put(seqKey(seq), []byte(key)); err != nil {
+			return err
+		}
+		if err := b.add(1); err != nil {
+			return err
+		}
+		return s.evict(b)
+	})
+}
+
+// evict removes the oldest entries while there are more than maxEntries or
+// they expired.
+func (s *BoltStore) evict(b *buckets) error {
+	c := b.order.Cursor()
+	for seq, key := c.First(); seq != nil; seq, key = c.First() {
+		raw := b.entries.Get(key)
+		var e entry
+		decoded := raw != nil && json.Unmarshal(raw, &e) == nil
+		current := decoded && bytes.Equal(seqKey(e.Seq), seq)
+		if current && b.count() <= s.maxEntries && s.now().Sub(e.StoredAt) <= s.ttl {
+			return nil
+		}
+
+		if err := b.order.Delete(seq); err != nil {
+			return err
+		}
+		if decoded && !current {
+			// The key was stored again under a later sequence
+			continue
+		}
+		// Undecodable entries are evicted too
+		if raw != nil {
+			if err := b.entries.Delete(key); err != nil {
+				return err
+			}
+			if err := b.add(-1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// buckets are the buckets of a BoltStore within one transaction.
+type buckets struct {
+	entries, order, meta *bolt.Bucket
+}
+
+func openBuckets(tx *bolt.Tx) (*buckets, error) {
+	if tx.Bucket(metaBucket) == nil && tx.Bucket(bucket) != nil {
+		// Entries stored before the index existed are not counted; they are
+		// only cached file_ids, so they are dropped
+		if err := tx.DeleteBucket(bucket); err != nil {
+			return nil, err
+		}
+	}
+	var b buckets
+	var err error
+	if b.entries, err = tx.CreateBucketIfNotExists(bucket); err != nil {
+		return nil, err
+	}
+	if b.order, err = tx.CreateBucketIfNotExists(orderBucket); err != nil {
+		return nil, err
+	}
+	if b.meta, err = tx.CreateBucketIfNotExists(metaBucket); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// remove deletes the entry under key and its place in the order.
+func (b *buckets) remove(key []byte) error {
+	raw := b.entries.Get(key)
+	if raw == nil {
+		return nil
+	}
+	var e entry
+	if json.Unmarshal(raw, &e) == nil && e.Seq != 0 {
+		if err := b.order.Delete(seqKey(e.Seq)); err != nil {
+			return err
+		}
+	}
+	if err := b.entries.Delete(key); err != nil {
+		return err
+	}
+	return b.add(-1)
+}
+
+func (b *buckets) count() int {
+	raw := b.meta.Get(countKey)
+	if len(raw) != 8 {
+		return 0
+	}
+	return int(binary.BigEndian.Uint64(raw))
+}
+
+func (b *buckets) add(delta int) error {
+	return b.meta.Put(countKey, binary.BigEndian.AppendUint64(nil, uint64(max(b.count()+delta, 0))))
+}
+
+// seqKey encodes seq so keys sort in sequence order.
+func seqKey(seq uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, seq)
+}
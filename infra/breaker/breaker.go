@@ -0,0 +1,75 @@
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrOpen is returned while the breaker rejects calls.
+var ErrOpen = errors.New("circuit breaker is open")
+
+// Breaker stops calls to an upstream that keeps failing. After Failures
+// consecutive failures it opens and rejects calls for Cooldown, then lets a
+// single trial call through: its success closes the breaker again, its
+// failure reopens it.
+type Breaker struct {
+	failures int
+	cooldown time.Duration
+	now      func() time.Time
+
+	mu          sync.Mutex
+	consecutive int
+	openedAt    time.Time
+	open        bool
+	trial       bool
+}
+
+// New returns a breaker opening after failures consecutive failures. A
+// failures of zero never opens.
+func New(failures int, cooldown time.Duration) *Breaker {
+	return &Breaker{failures: failures, cooldown: cooldown, now: time.Now}
+}
+
+// Allow reports with ErrOpen whether the call must be skipped. Every allowed
+// call must be followed by Done.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.open {
+		return nil
+	}
+	if b.trial || b.now().Sub(b.openedAt) < b.cooldown {
+		return ErrOpen
+	}
+	b.trial = true
+	return nil
+}
+
+// Done records the outcome of an allowed call.
+func (b *Breaker) Done(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !failed {
+		b.consecutive = 0
+		b.open = false
+		b.trial = false
+		return
+	}
+
+	b.consecutive++
+	if b.trial || (b.failures > 0 && b.consecutive >= b.failures) {
+		b.open = true
+		b.trial = false
+		b.openedAt = b.now()
+	}
+}
+
+// Open reports whether calls are currently rejected.
+func (b *Breaker) Open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.open
+}
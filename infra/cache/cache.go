@@ -0,0 +1,212 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var errLoadPanicked = errors.New("cache: load panicked")
+
+// Config bounds a Cache.
+type Config[V any] struct {
+	// TTL is how long successful results are kept; zero disables caching
+	// them.
+	TTL time.Duration
+	// NegativeTTL is how long errors accepted by Negative are kept.
+	NegativeTTL time.Duration
+	MaxEntries  int
+	// Negative reports whether an error is final, e.g. a deleted post, and
+	// may be cached. Other errors are never cached.
+	Negative func(error) bool
+	// Keep reports whether a successful result may be cached; nil keeps all.
+	Keep func(V) bool
+	// LoadTimeout bounds a load, which outlives the request that started
+	// it while others wait for it; zero leaves it unbounded.
+	LoadTimeout time.Duration
+}
+
+// Stats counts how requests were answered.
+type Stats struct {
+	Hits         uint64 `json:"hits"`
+	NegativeHits uint64 `json:"negative_hits"`
+	Misses       uint64 `json:"misses"`
+	// Coalesced requests waited for a load already in flight.
+	Coalesced uint64 `json:"coalesced"`
+}
+
+// Cache keeps the results of a loader by key, least recently used first out,
+// and makes concurrent requests for the same key share one load.
+type Cache[V any] struct {
+	cfg Config[V]
+	now func() time.Time
+
+	mu       sync.Mutex
+	order    *list.List
+	entries  map[string]*list.Element
+	inFlight map[string]*call[V]
+
+	hits, negativeHits, misses, coalesced atomic.Uint64
+}
+
+type item[V any] struct {
+	key     string
+	value   V
+	err     error
+	expires time.Time
+}
+
+type call[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+
+	// waiters counts the requests waiting for the load, which is cancelled
+	// when the last of them gives up; guarded by Cache.mu
+	waiters int
+	cancel  context.CancelFunc
+}
+
+func New[V any](cfg Config[V]) *Cache[V] {
+	if cfg.Negative == nil {
+		cfg.Negative = func(error) bool { return false }
+	}
+	if cfg.Keep == nil {
+		cfg.Keep = func(V) bool { return true }
+	}
+	return &Cache[V]{
+		cfg:      cfg,
+		now:      time.Now,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+		inFlight: make(map[string]*call[V]),
+	}
+}
+
+// Get returns the result cached under key, calling load on a miss. Requests
+// for the same key share the load, so it runs on a context detached from the
+// cancellation of ctx; each request gives up waiting for it when its own ctx
+// is done, and the load is cancelled once no request waits for it.
+func (c *Cache[V]) Get(ctx context.Context, key string, load func(context.Context) (V, error)) (V, error) {
+	c.mu.Lock()
+	if elem, ok := c.entries[key]; ok {
+		it := elem.Value.(*item[V])
+		if c.now().Before(it.expires) {
+			c.order.MoveToFront(elem)
+			c.mu.Unlock()
+			if it.err != nil {
+				c.negativeHits.Add(1)
+			} else {
+				c.hits.Add(1)
+			}
+			return it.value, it.err
+		}
+		c.order.Remove(elem)
+		delete(c.entries, key)
+	}
+	cl, ok := c.inFlight[key]
+	if ok {
+		c.coalesced.Add(1)
+	} else {
+		loadCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		cl = &call[V]{done: make(chan struct{}), cancel: cancel}
+		c.inFlight[key] = cl
+		c.misses.Add(1)
+		go c.load(loadCtx, key, cl, load)
+	}
+	cl.waiters++
+	c.mu.Unlock()
+
+	select {
+	case <-cl.done:
+		return cl.value, cl.err
+	case <-ctx.Done():
+		c.leave(key, cl)
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+// leave drops a request that gave up waiting on cl, cancelling the load when
+// it was the last one. Later requests for key start a new load.
+func (c *Cache[V]) leave(key string, cl *call[V]) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cl.waiters--; cl.waiters > 0 {
+		return
+	}
+	if c.inFlight[key] == cl {
+		delete(c.inFlight, key)
+	}
+	cl.cancel()
+}
+
+// load runs fn for key on ctx, stores the result and hands it to the
+// requests waiting on cl.
+func (c *Cache[V]) load(ctx context.Context, key string, cl *call[V], fn func(context.Context) (V, error)) {
+	defer cl.cancel()
+	if c.cfg.LoadTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.cfg.LoadTimeout)
+		defer cancel()
+	}
+
+	loaded := false
+	defer func() {
+		// The load runs on its own goroutine, where a panic would crash
+		// the bot; waiters get errLoadPanicked instead
+		if r := recover(); r != nil {
+			cl.err = fmt.Errorf("%w: %v", errLoadPanicked, r)
+		}
+		c.mu.Lock()
+		if c.inFlight[key] == cl {
+			delete(c.inFlight, key)
+		}
+		if loaded {
+			c.store(key, cl.value, cl.err)
+		}
+		c.mu.Unlock()
+		close(cl.done)
+	}()
+
+	cl.value, cl.err = fn(ctx)
+	loaded = true
+}
+
+// store keeps a loaded result; c.mu must be held.
+func (c *Cache[V]) store(key string, value V, err error) {
+	ttl := c.cfg.TTL
+	if err == nil && !c.cfg.Keep(value) {
+		return
+	}
+	if err != nil {
+		// A cancelled or timed out load says nothing about the key
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || !c.cfg.Negative(err) {
+			return
+		}
+		ttl = c.cfg.NegativeTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&item[V]{key: key, value: value, err: err, expires: c.now().Add(ttl)})
+	for c.order.Len() > c.cfg.MaxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*item[V]).key)
+	}
+}
+
+func (c *Cache[V]) Stats() Stats {
+	return Stats{
+		Hits:         c.hits.Load(),
+		NegativeHits: c.negativeHits.Load(),
+		Misses:       c.misses.Load(),
+		Coalesced:    c.coalesced.Load(),
+	}
+}
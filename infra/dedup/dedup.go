@@ -0,0 +1,68 @@
+package dedup
+
+import (
+	"sync"
+	"time"
+)
+
+// Store remembers keys for a limited time. Implementations must be safe for
+// concurrent use; a persistent store lets de-duplication survive restarts.
+type Store interface {
+	// Seen marks key as seen for ttl and reports whether it was already
+	// marked and not yet expired.
+	Seen(key string, ttl time.Duration) (bool, error)
+	// Forget unmarks key, e.g. for work that was cut short and may be
+	// done again.
+	Forget(key string) error
+}
+
+// MemoryStore is an in-process Store.
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]time.Time
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// sweepInterval bounds how often expired keys are purged.
+const sweepInterval = time.Minute
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: make(map[string]time.Time),
+		now:     time.Now,
+	}
+}
+
+func (s *MemoryStore) Seen(key string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.lastSweep) > sweepInterval {
+		s.sweep(now)
+	}
+
+	expires, ok := s.entries[key]
+	seen := ok && now.Before(expires)
+	if !seen {
+		s.entries[key] = now.Add(ttl)
+	}
+	return seen, nil
+}
+
+func (s *MemoryStore) Forget(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, expires := range s.entries {
+		if !now.Before(expires) {
+			delete(s.entries, key)
+		}
+	}
+	s.lastSweep = now
+}
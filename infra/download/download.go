@@ -0,0 +1,115 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+)
+
+// ErrTooLarge is returned for files over the size limit.
+var ErrTooLarge = errors.New("file exceeds the upload size limit")
+
+// File is a file downloaded into memory.
+type File struct {
+	Name string
+	Data []byte
+}
+
+// Downloader fetches files the bot uploads itself, bounded in size and time.
+type Downloader struct {
+	client   *http.Client
+	maxBytes int64
+	timeout  time.Duration
+}
+
+// NewDownloader expects client to accept bodies of maxBytes bytes.
+func NewDownloader(client *http.Client, maxBytes int64, timeout time.Duration) *Downloader {
+	return &Downloader{
+		client:   client,
+		maxBytes: maxBytes,
+		timeout:  timeout,
+	}
+}
+
+// Get downloads rawURL, giving up when ctx is done or the download timeout
+// passes. The origin of referer, usually the post the file belongs to, is
+// sent as Referer for CDNs that check it.
+func (d *Downloader) Get(ctx context.Context, rawURL, referer string) (*File, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if ref, err := url.Parse(referer); err == nil && ref.Host != "" {
+		req.Header.Set("Referer", ref.Scheme+"://"+ref.Host+"/")
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: %s", rawURL, resp.Status)
+	}
+	if resp.ContentLength > d.maxBytes {
+		return nil, ErrTooLarge
+	}
+
+	buf := new(bytes.Buffer)
+	// Read one byte past the limit to tell a full-size file from a larger one
+	if _, err := io.Copy(buf, io.LimitReader(resp.Body, d.maxBytes+1)); err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", rawURL, err)
+	}
+	if int64(buf.Len()) > d.maxBytes {
+		return nil, ErrTooLarge
+	}
+
+	return &File{
+		Name: fileName(rawURL, resp.Header.Get("Content-Type")),
+		Data: buf.Bytes(),
+	}, nil
+}
+
+// extensions are preferred over mime.ExtensionsByType, which lists rarely
+// used extensions first for common types.
+var extensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+	"video/mp4":  ".mp4",
+	"audio/mpeg": ".mp3",
+}
+
+// fileName names the upload after the URL path, adding an extension from the
+// content type when the path has none.
+func fileName(rawURL, contentType string) string {
+	name := "file"
+	if u, err := url.Parse(rawURL); err == nil {
+		if base := path.Base(u.Path); base != "." && base != "/" {
+			name = base
+		}
+	}
+	if path.Ext(name) != "" {
+		return name
+	}
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		if ext, ok := extensions[mediaType]; ok {
+			return name + ext
+		}
+		if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+			return name + exts[0]
+		}
+	}
+	return name
+}
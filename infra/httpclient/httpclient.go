@@ -0,0 +1,216 @@
+package httpclient
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"thumb-bot/infra/logs"
+	"thumb-bot/infra/ratelimit"
+	"thumb-bot/infra/tracing"
+	"thumb-bot/integration"
+	"time"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.uber.org/zap"
+)
+
+// ErrBodyTooLarge is returned for a response body over the limit. It wraps
+// integration.ErrTooLarge, so the failure is reported like any media too
+// large to send.
+var ErrBodyTooLarge = fmt.Errorf("response body exceeds the size limit: %w", integration.ErrTooLarge)
+
+// Config applies to every client made by a Factory.
+type Config struct {
+	Timeout time.Duration
+	// UserAgent is sent on requests that do not set their own.
+	UserAgent string
+	// Proxy is the URL of the proxy for outbound requests. When empty the
+	// standard HTTP_PROXY, HTTPS_PROXY and NO_PROXY variables apply.
+	Proxy string
+	// MaxBodyBytes bounds response bodies; zero means no limit.
+	MaxBodyBytes int64
+	// HostLimit paces the requests to each host across all clients.
+	HostLimit ratelimit.Limit
+	// Transport, when set, makes the requests instead of a clone of
+	// http.DefaultTransport, e.g. to answer them in-process in tests. Proxy
+	// is ignored then.
+	Transport http.RoundTripper
+}
+
+// Factory makes the HTTP clients of the integrations. Clients share one
+// transport, and so its connection pool.
+type Factory struct {
+	logger    *zap.Logger
+	cfg       Config
+	transport http.RoundTripper
+	hosts     *ratelimit.Limiter
+}
+
+// NewFactory fails only for an invalid proxy URL.
+func NewFactory(logger *zap.Logger, cfg Config) (*Factory, error) {
+	if cfg.Transport != nil {
+		return &Factory{logger: logger, cfg: cfg, transport: cfg.Transport, hosts: ratelimit.New(cfg.HostLimit)}, nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.Proxy != "" {
+		proxy, err := url.Parse(cfg.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	return &Factory{logger: logger, cfg: cfg, transport: transport, hosts: ratelimit.New(cfg.HostLimit)}, nil
+}
+
+// Option customizes a single client.
+type Option func(*options)
+
+type options struct {
+	timeout        time.Duration
+	maxBodyBytes   int64
+	cookies        bool
+	followRedirect bool
+}
+
+// WithTimeout overrides the factory timeout.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) { o.timeout = d }
+}
+
+// WithMaxBodyBytes overrides the factory body limit, e.g. for downloads.
+func WithMaxBodyBytes(n int64) Option {
+	return func(o *options) { o.maxBodyBytes = n }
+}
+
+// WithCookies keeps cookies across the requests of the client.
+func WithCookies() Option {
+	return func(o *options) { o.cookies = true }
+}
+
+// WithoutRedirects returns redirect responses instead of following them.
+func WithoutRedirects() Option {
+	return func(o *options) { o.followRedirect = false }
+}
+
+// Client returns a new client named after the integration using it, which
+// appears in its request logs.
+func (f *Factory) Client(name string, opts ...Option) *http.Client {
+	o := options{
+		timeout:        f.cfg.Timeout,
+		maxBodyBytes:   f.cfg.MaxBodyBytes,
+		followRedirect: true,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	client := &http.Client{
+		Timeout: o.timeout,
+		Transport: &transport{
+			base:         f.transport,
+			hosts:        f.hosts,
+			logger:       f.logger,
+			name:         name,
+			userAgent:    f.cfg.UserAgent,
+			maxBodyBytes: o.maxBodyBytes,
+		},
+	}
+	if o.cookies {
+		// cookiejar.New only fails for a broken public suffix list, and none
+		// is given
+		client.Jar, _ = cookiejar.New(nil)
+	}
+	if !o.followRedirect {
+		client.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+	return client
+}
+
+// transport paces requests per host, sets the User-Agent, bounds response
+// bodies and logs every request with its host.
+type transport struct {
+	base         http.RoundTripper
+	hosts        *ratelimit.Limiter
+	logger       *zap.Logger
+	name         string
+	userAgent    string
+	maxBodyBytes int64
+}
+
+func (t *transport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	// The span covers the wait for the host limiter too
+	ctx, span := tracing.Start(req.Context(), "HTTP "+req.Method,
+		semconv.HTTPRequestMethodKey.String(req.Method),
+		semconv.ServerAddress(req.URL.Host),
+		semconv.URLPath(req.URL.Path),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	if err := t.hosts.Wait(ctx, req.URL.Host); err != nil {
+		return nil, err
+	}
+
+	// RoundTrippers must not modify the caller's request
+	req = req.Clone(ctx)
+	if t.userAgent != "" && req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", t.userAgent)
+	}
+
+	start := time.Now()
+	resp, err = t.base.RoundTrip(req)
+	// Requests made for an update are logged with its logger
+	logger := logs.FromContext(ctx, t.logger)
+	fields := []zap.Field{
+		zap.String("client", t.name),
+		zap.String("host", req.URL.Host),
+		zap.String("method", req.Method),
+		zap.Duration("duration", time.Since(start)),
+	}
+	if err != nil {
+		logger.Warn("upstream request failed", append(fields, zap.Error(err))...)
+		return nil, err
+	}
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	logger.Debug("upstream request", append(fields, zap.Int("status", resp.StatusCode))...)
+
+	if t.maxBodyBytes > 0 {
+		if resp.ContentLength > t.maxBodyBytes {
+			resp.Body.Close()
+			return nil, fmt.Errorf("%s: %w", req.URL.Host, ErrBodyTooLarge)
+		}
+		resp.Body = &limitedBody{body: resp.Body, remaining: t.maxBodyBytes}
+	}
+	return resp, nil
+}
+
+// limitedBody fails reads past its limit instead of truncating silently.
+type limitedBody struct {
+	body      io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		// Tell a body ending exactly at the limit from a longer one
+		var probe [1]byte
+		if _, err := io.ReadAtLeast(b.body, probe[:], 1); err != nil {
+			return 0, err
+		}
+		return 0, ErrBodyTooLarge
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.body.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
+
+func (b *limitedBody) Close() error {
+	return b.body.Close()
+}
@@ -0,0 +1,72 @@
+package logs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+type (
+	loggerKey        struct{}
+	correlationIDKey struct{}
+)
+
+// WithLogger returns a copy of ctx carrying logger.
+func WithLogger(ctx context.Context, logger *zap.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the logger carried by ctx, or fallback when there is
+// none.
+func FromContext(ctx context.Context, fallback *zap.Logger) *zap.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*zap.Logger); ok {
+		return logger
+	}
+	return fallback
+}
+
+// ForUpdate returns a copy of ctx carrying a child of base tagged with the
+// update, its chat and a correlation ID shared by every line logged while
+// handling it. A correlation ID already in ctx is kept; otherwise it is the
+// trace ID when ctx is traced.
+func ForUpdate(ctx context.Context, base *zap.Logger, updateID int, chatID int64) context.Context {
+	fields := []zap.Field{
+		zap.Int("update_id", updateID),
+		zap.Int64("chat_id", chatID),
+	}
+	correlationID := CorrelationID(ctx)
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		if correlationID == "" {
+			correlationID = sc.TraceID().String()
+		}
+		fields = append(fields, zap.String("trace_id", sc.TraceID().String()))
+	}
+	if correlationID == "" {
+		correlationID = newCorrelationID()
+	}
+	fields = append(fields, zap.String("correlation_id", correlationID))
+
+	ctx = context.WithValue(ctx, correlationIDKey{}, correlationID)
+	return WithLogger(ctx, base.With(fields...))
+}
+
+// CorrelationID returns the correlation ID set by ForUpdate, or "".
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
+
+// WithProvider returns a copy of ctx whose logger is tagged with provider.
+func WithProvider(ctx context.Context, fallback *zap.Logger, provider string) context.Context {
+	return WithLogger(ctx, FromContext(ctx, fallback).With(zap.String("provider", provider)))
+}
+
+func newCorrelationID() string {
+	var b [8]byte
+	// crypto/rand does not fail on supported platforms
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -1,22 +1,41 @@
 package logs
 
 import (
+	"time"
+
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
-func NewLogger(logLevel zapcore.Level) *zap.Logger {
-	logger, err := configureLogger(logLevel)
+// Config describes the logger made by NewLogger.
+type Config struct {
+	Level zapcore.Level
+	// Encoding is json or console; empty means json.
+	Encoding string
+	Sampling Sampling
+}
+
+// Sampling keeps, per message and second, the first Initial debug and info
+// lines and every Thereafter-th after that. Warnings and errors are never
+// sampled; zero Initial disables sampling.
+type Sampling struct {
+	Initial    int
+	Thereafter int
+}
+
+// NewLogger builds the logger described by cfg and makes it the global one.
+// The returned level changes the level of the logger at runtime.
+func NewLogger(cfg Config) (*zap.Logger, zap.AtomicLevel) {
+	level := zap.NewAtomicLevelAt(cfg.Level)
+	logger, err := configureLogger(cfg, level)
 	if err != nil {
 		panic(err)
 	}
 	zap.ReplaceGlobals(logger)
-	return zap.L()
+	return zap.L(), level
 }
 
-func configureLogger(logLevel zapcore.Level) (*zap.Logger, error) {
-	var zapConfig zap.Config
-
+func configureLogger(cfg Config, level zap.AtomicLevel) (*zap.Logger, error) {
 	encodingConfig := zapcore.EncoderConfig{
 		TimeKey:        "time",
 		LevelKey:       "level",
@@ -31,18 +50,42 @@ func configureLogger(logLevel zapcore.Level) (*zap.Logger, error) {
 		EncodeDuration: zapcore.StringDurationEncoder,
 	}
 
-	zapConfig = zap.Config{
-		Level:            zap.NewAtomicLevelAt(logLevel),
-		Encoding:         "json",
-		EncoderConfig:    encodingConfig,
-		OutputPaths:      []string{"stdout"},
-		ErrorOutputPaths: []string{"stderr"},
+	var encoder zapcore.Encoder
+	if cfg.Encoding == "console" {
+		encoder = zapcore.NewConsoleEncoder(encodingConfig)
+	} else {
+		encoder = zapcore.NewJSONEncoder(encodingConfig)
 	}
 
-	logger, err := zapConfig.Build()
+	sink, closeSink, err := zap.Open("stdout")
 	if err != nil {
 		return nil, err
 	}
+	errSink, _, err := zap.Open("stderr")
+	if err != nil {
+		closeSink()
+		return nil, err
+	}
+
+	var core zapcore.Core = redactCore{zapcore.NewCore(encoder, sink, level), level}
+	if cfg.Sampling.Initial > 0 {
+		// Only the high-volume levels are sampled
+		sampled := zap.LevelEnablerFunc(func(l zapcore.Level) bool {
+			return l <= zapcore.InfoLevel && level.Enabled(l)
+		})
+		kept := zap.LevelEnablerFunc(func(l zapcore.Level) bool {
+			return l > zapcore.InfoLevel && level.Enabled(l)
+		})
+		core = zapcore.NewTee(
+			zapcore.NewSamplerWithOptions(redactCore{zapcore.NewCore(encoder, sink, sampled), level},
+				time.Second, cfg.Sampling.Initial, cfg.Sampling.Thereafter),
+			redactCore{zapcore.NewCore(encoder.Clone(), sink, kept), level},
+		)
+	}
 
-	return logger, nil
+	return zap.New(core,
+		zap.ErrorOutput(errSink),
+		zap.AddCaller(),
+		zap.AddStacktrace(zapcore.ErrorLevel),
+	), nil
 }
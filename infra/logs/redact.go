@@ -0,0 +1,97 @@
+package logs
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Fields rewritten by the redaction policy unless debug logging is enabled.
+const (
+	// UserIDKey values, Telegram user IDs, are replaced by a keyed hash
+	// that still tells users apart within a run.
+	UserIDKey = "user_id"
+	// TextKey values, message text, are replaced by their length.
+	TextKey = "text"
+)
+
+// redactionKey keys the user ID hashes. It is drawn per process so hashes
+// cannot be reversed by hashing every possible ID.
+var redactionKey = func() []byte {
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	return key
+}()
+
+// redactCore applies the redaction policy to the fields of the core it wraps,
+// unless level enables debug logging. It wraps cores that write, as a Tee
+// writes to all its cores regardless of their level.
+type redactCore struct {
+	zapcore.Core
+	level zapcore.LevelEnabler
+}
+
+func (c redactCore) With(fields []zapcore.Field) zapcore.Core {
+	return redactCore{c.Core.With(c.redact(fields)), c.level}
+}
+
+func (c redactCore) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return ce.AddCore(entry, c)
+	}
+	return ce
+}
+
+func (c redactCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	return c.Core.Write(entry, c.redact(fields))
+}
+
+// redact returns fields with the sensitive ones rewritten, leaving them as
+// they are when debug logging is enabled.
+func (c redactCore) redact(fields []zapcore.Field) []zapcore.Field {
+	if c.level.Enabled(zapcore.DebugLevel) {
+		return fields
+	}
+	// Copy only when a field is rewritten, leaving fields to the caller
+	var out []zapcore.Field
+	for i, field := range fields {
+		redacted, ok := redactField(field)
+		switch {
+		case ok && out == nil:
+			out = append(make([]zapcore.Field, 0, len(fields)), fields[:i]...)
+			out = append(out, redacted)
+		case ok:
+			out = append(out, redacted)
+		case out != nil:
+			out = append(out, field)
+		}
+	}
+	if out == nil {
+		return fields
+	}
+	return out
+}
+
+// redactField rewrites field when the policy covers it.
+func redactField(field zapcore.Field) (zapcore.Field, bool) {
+	switch {
+	case field.Key == UserIDKey && field.Type == zapcore.Int64Type:
+		return zap.String(UserIDKey, HashID(field.Integer)), true
+	case field.Key == TextKey && field.Type == zapcore.StringType:
+		return zap.Int("text_length", utf8.RuneCountInString(field.String)), true
+	}
+	return field, false
+}
+
+// HashID returns the keyed hash logged in place of a user ID.
+func HashID(id int64) string {
+	mac := hmac.New(sha256.New, redactionKey)
+	mac.Write([]byte(strconv.FormatInt(id, 10)))
+	return "u_" + hex.EncodeToString(mac.Sum(nil)[:6])
+}
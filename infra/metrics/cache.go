@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"thumb-bot/infra/cache"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var providerCacheRequests = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "", "provider_cache_requests_total"),
+	"Provider cache requests by provider and result: hit, negative_hit, miss or coalesced.",
+	[]string{"provider", "result"}, nil,
+)
+
+// RegisterProviderCache reports the provider cache counters, read from stats
+// on every scrape. It is called once, by the long-running server.
+func RegisterProviderCache(stats func() map[string]cache.Stats) {
+	registry.MustRegister(cacheCollector(stats))
+}
+
+// cacheCollector exports the counters the caches already keep rather than
+// counting every request twice.
+type cacheCollector func() map[string]cache.Stats
+
+func (c cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- providerCacheRequests
+}
+
+func (c cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	for provider, s := range c() {
+		for result, count := range map[string]uint64{
+			"hit":          s.Hits,
+			"negative_hit": s.NegativeHits,
+			"miss":         s.Misses,
+			"coalesced":    s.Coalesced,
+		} {
+			ch <- prometheus.MustNewConstMetric(providerCacheRequests, prometheus.CounterValue, float64(count), provider, result)
+		}
+	}
+}
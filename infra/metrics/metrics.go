@@ -0,0 +1,112 @@
+// Package metrics holds the Prometheus collectors of the bot and the handler
+// serving them.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "thumbbot"
+
+var registry = prometheus.NewRegistry()
+
+var (
+	// UpdatesReceived counts updates received by type.
+	UpdatesReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "updates_received_total",
+		Help:      "Updates received from Telegram by type.",
+	}, []string{"type"})
+
+	// LinksDetected counts links handled by provider.
+	LinksDetected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "links_detected_total",
+		Help:      "Links detected in messages by provider.",
+	}, []string{"provider"})
+
+	// ProviderFetchDuration observes provider fetches by provider and outcome.
+	ProviderFetchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "provider_fetch_duration_seconds",
+		Help:      "Duration of provider fetches that missed the cache, by provider and outcome.",
+		Buckets:   []float64{.1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"provider", "outcome"})
+
+	// TwitterFallbacks counts tweets fetched from vxtwitter after fxtwitter
+	// failed.
+	TwitterFallbacks = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "twitter_fallbacks_total",
+		Help:      "Tweets fetched from vxtwitter after fxtwitter failed.",
+	})
+
+	// InstagramRetries counts GraphQL requests retried after a throttle.
+	InstagramRetries = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "instagram_retries_total",
+		Help:      "Instagram GraphQL requests retried after being throttled.",
+	})
+
+	// InstagramCSRFRefreshes counts CSRF tokens fetched from Instagram.
+	InstagramCSRFRefreshes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "instagram_csrf_refreshes_total",
+		Help:      "CSRF tokens fetched from Instagram.",
+	})
+
+	// TelegramRequestDuration observes Bot API calls by method.
+	TelegramRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "telegram_request_duration_seconds",
+		Help:      "Duration of Bot API calls by method.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"method"})
+
+	// TelegramErrors counts failed Bot API calls by method.
+	TelegramErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "telegram_errors_total",
+		Help:      "Failed Bot API calls by method.",
+	}, []string{"method"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		UpdatesReceived,
+		LinksDetected,
+		ProviderFetchDuration,
+		TwitterFallbacks,
+		InstagramRetries,
+		InstagramCSRFRefreshes,
+		TelegramRequestDuration,
+		TelegramErrors,
+	)
+}
+
+// RegisterQueueDepth reports the updates waiting in the queue, read from
+// depth on every scrape. It is called once, when the queue is created.
+func RegisterQueueDepth(depth func() int) {
+	registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queue_depth",
+		Help:      "Updates waiting in the queue.",
+	}, func() float64 { return float64(depth()) }))
+}
+
+// Since returns the seconds elapsed since start, for histograms.
+func Since(start time.Time) float64 {
+	return time.Since(start).Seconds()
+}
+
+// Handler serves the collectors in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
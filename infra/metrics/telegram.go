@@ -0,0 +1,30 @@
+package metrics
+
+import (
+	"path"
+	"time"
+
+	ta "github.com/mymmrac/telego/telegoapi"
+)
+
+// telegramCaller observes the Bot API calls made through it.
+type telegramCaller struct {
+	next ta.Caller
+}
+
+// NewTelegramCaller wraps next, labelling calls with the method name taken
+// from the end of the request URL so the token never becomes a label.
+func NewTelegramCaller(next ta.Caller) ta.Caller {
+	return telegramCaller{next: next}
+}
+
+func (c telegramCaller) Call(url string, data *ta.RequestData) (*ta.Response, error) {
+	method := path.Base(url)
+	start := time.Now()
+	resp, err := c.next.Call(url, data)
+	TelegramRequestDuration.WithLabelValues(method).Observe(Since(start))
+	if err != nil || resp == nil || !resp.Ok {
+		TelegramErrors.WithLabelValues(method).Inc()
+	}
+	return resp, err
+}
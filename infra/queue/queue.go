@@ -0,0 +1,174 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mymmrac/telego"
+	"go.uber.org/zap"
+)
+
+// OverflowPolicy decides what Submit does when the queue is full.
+type OverflowPolicy string
+
+const (
+	// OverflowReject refuses the update so the caller can ask Telegram to redeliver it later.
+	OverflowReject OverflowPolicy = "reject"
+	// OverflowDrop discards the update.
+	OverflowDrop OverflowPolicy = "drop"
+	// OverflowBlock waits up to Config.BlockTimeout for room, then rejects.
+	OverflowBlock OverflowPolicy = "block"
+)
+
+var (
+	// ErrQueueFull is returned when an update was refused and should be redelivered.
+	ErrQueueFull = errors.New("queue is full")
+	// ErrDropped is returned when an update was discarded under OverflowDrop.
+	ErrDropped = errors.New("queue is full, update dropped")
+	// ErrClosed is returned by Submit after Shutdown.
+	ErrClosed = errors.New("queue is closed")
+)
+
+type Config struct {
+	Workers      int
+	Size         int
+	Overflow     OverflowPolicy
+	BlockTimeout time.Duration
+}
+
+func ParseOverflowPolicy(raw string) (OverflowPolicy, error) {
+	switch policy := OverflowPolicy(raw); policy {
+	case OverflowReject, OverflowDrop, OverflowBlock:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown overflow policy %q, expected reject, drop or block", raw)
+	}
+}
+
+// Pool processes updates on a fixed number of workers fed by a bounded queue.
+type Pool struct {
+	logger *zap.Logger
+	cfg    Config
+	handle func(context.Context, telego.Update) error
+
+	// ctx is cancelled when Shutdown gives up waiting for the workers
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	jobs   chan telego.Update
+	wg     sync.WaitGroup
+	mu     sync.RWMutex
+	closed bool
+
+	// quit releases Submit calls blocked on a full queue when Shutdown
+	// starts, so they do not hold mu while it waits to close jobs
+	quit     chan struct{}
+	quitOnce sync.Once
+}
+
+func NewPool(logger *zap.Logger, cfg Config, handle func(context.Context, telego.Update) error) *Pool {
+	if cfg.Workers < 1 {
+		cfg.Workers = 1
+	}
+	if cfg.Size < 0 {
+		cfg.Size = 0
+	}
+	if cfg.Overflow == "" {
+		cfg.Overflow = OverflowReject
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Pool{
+		logger: logger,
+		cfg:    cfg,
+		handle: handle,
+		ctx:    ctx,
+		cancel: cancel,
+		jobs:   make(chan telego.Update, cfg.Size),
+		quit:   make(chan struct{}),
+	}
+
+	p.wg.Add(cfg.Workers)
+	for i := 0; i < cfg.Workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+func (p *Pool) work() {
+	defer p.wg.Done()
+	for update := range p.jobs {
+		if err := p.handle(p.ctx, update); err != nil {
+			p.logger.Error("failed to process update", zap.Int("update_id", update.UpdateID), zap.Error(err))
+		}
+	}
+}
+
+// Submit queues update for processing, applying the overflow policy when
+// the queue is full.
+func (p *Pool) Submit(update telego.Update) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrClosed
+	}
+
+	select {
+	case p.jobs <- update:
+		return nil
+	default:
+	}
+
+	switch p.cfg.Overflow {
+	case OverflowDrop:
+		return ErrDropped
+	case OverflowBlock:
+		timer := time.NewTimer(p.cfg.BlockTimeout)
+		defer timer.Stop()
+		select {
+		case p.jobs <- update:
+			return nil
+		case <-timer.C:
+			return ErrQueueFull
+		case <-p.quit:
+			return ErrClosed
+		}
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Len returns the number of updates waiting for a worker.
+func (p *Pool) Len() int {
+	return len(p.jobs)
+}
+
+// Shutdown stops accepting updates and waits for queued ones to finish or
+// for ctx to expire, cancelling the updates still in flight then.
+func (p *Pool) Shutdown(ctx context.Context) error {
+	p.quitOnce.Do(func() { close(p.quit) })
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.jobs)
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		p.cancel()
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		return ctx.Err()
+	}
+}
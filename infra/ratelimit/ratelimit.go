@@ -0,0 +1,140 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limit is a token bucket refilled at PerMinute tokens a minute and holding
+// at most Burst tokens. A zero PerMinute disables limiting.
+type Limit struct {
+	PerMinute float64
+	Burst     int
+}
+
+// Limiter keeps one token bucket per key, e.g. per user or per host.
+type Limiter struct {
+	limit Limit
+	now   func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// sweepInterval bounds how often full, idle buckets are dropped.
+const sweepInterval = time.Minute
+
+func New(limit Limit) *Limiter {
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+	return &Limiter{
+		limit:   limit,
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow takes a token for key and reports whether one was available.
+func (l *Limiter) Allow(key string) bool {
+	_, ok := l.take(key, false)
+	return ok
+}
+
+// Wait takes a token for key, waiting for one to be refilled or until ctx
+// is done.
+func (l *Limiter) Wait(ctx context.Context, key string) error {
+	delay, _ := l.take(key, true)
+	if delay == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.Refund(key)
+		return ctx.Err()
+	}
+}
+
+// take takes a token for key when one is available. Otherwise, when wait is
+// set, it takes the next token to be refilled and returns how long until
+// then; waiters queue up by leaving the bucket in debt.
+func (l *Limiter) take(key string, wait bool) (time.Duration, bool) {
+	if l.limit.PerMinute <= 0 {
+		return 0, true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+	b := l.refill(key, now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	if !wait {
+		return 0, false
+	}
+
+	missing := 1 - b.tokens
+	b.tokens--
+	return time.Duration(missing / l.limit.PerMinute * float64(time.Minute)), true
+}
+
+// Refund gives back a token taken for key that went unused, e.g. when
+// another limiter rejected the same request.
+func (l *Limiter) Refund(key string) {
+	if l.limit.PerMinute <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if b, ok := l.buckets[key]; ok {
+		b.tokens++
+	}
+}
+
+// refill returns the bucket of key with the tokens earned since it was last
+// used; l.mu must be held.
+func (l *Limiter) refill(key string, now time.Time) *bucket {
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.limit.Burst), last: now}
+		l.buckets[key] = b
+		return b
+	}
+	b.tokens += now.Sub(b.last).Minutes() * l.limit.PerMinute
+	if max := float64(l.limit.Burst); b.tokens > max {
+		b.tokens = max
+	}
+	b.last = now
+	return b
+}
+
+// sweep drops buckets that refilled completely, which behave like new ones;
+// l.mu must be held.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	full := time.Duration(float64(l.limit.Burst) / l.limit.PerMinute * float64(time.Minute))
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, key)
+		}
+	}
+}
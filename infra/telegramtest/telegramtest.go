@@ -0,0 +1,310 @@
+// Package telegramtest provides an in-process fake of the Telegram Bot API
+// for tests. It records every call made to it and answers the methods the
+// bot uses with plausible results.
+package telegramtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mymmrac/telego"
+)
+
+// Token is a well-formed bot token accepted by the fake server.
+const Token = "1234567890:AAHdqTcvCH1vGWJxfSeofSAs0K5PALDsawQ"
+
+// BotUsername is the username getMe answers with.
+const BotUsername = "thumb_test_bot"
+
+// File is a file uploaded in a multipart call.
+type File struct {
+	Name string
+	Data []byte
+}
+
+// Call is a recorded Bot API call. Params hold the top-level parameters as
+// strings; objects and arrays keep their JSON encoding.
+type Call struct {
+	Method string
+	Params map[string]string
+	Files  map[string]File
+}
+
+// Int returns the integer parameter key, or zero.
+func (c Call) Int(key string) int64 {
+	n, _ := strconv.ParseInt(c.Params[key], 10, 64)
+	return n
+}
+
+// Media is an item of the media parameter of sendMediaGroup.
+type Media struct {
+	Type       string `json:"type"`
+	Media      string `json:"media"`
+	Caption    string `json:"caption"`
+	HasSpoiler bool   `json:"has_spoiler"`
+}
+
+// Media decodes the media parameter of a sendMediaGroup call.
+func (c Call) Media() ([]Media, error) {
+	var media []Media
+	err := json.Unmarshal([]byte(c.Params["media"]), &media)
+	return media, err
+}
+
+// Server is a fake Bot API server.
+type Server struct {
+	server *httptest.Server
+
+	mu        sync.Mutex
+	calls     []Call
+	failures  map[string][]string
+	admins    map[int64]bool
+	messageID int
+}
+
+// NewServer starts a fake server; Close stops it.
+func NewServer() *Server {
+	s := &Server{
+		failures: make(map[string][]string),
+		admins:   make(map[int64]bool),
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// URL is the API server URL to give telego.WithAPIServer.
+func (s *Server) URL() string {
+	return s.server.URL
+}
+
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// NewBot returns a bot pointed at the server.
+func (s *Server) NewBot() (*telego.Bot, error) {
+	return telego.NewBot(Token, telego.WithAPIServer(s.URL()), telego.WithDiscardLogger())
+}
+
+// Calls returns the recorded calls, only those of methods when given.
+func (s *Server) Calls(methods ...string) []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var calls []Call
+	for _, call := range s.calls {
+		if len(methods) == 0 || contains(methods, call.Method) {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// Reset forgets the recorded calls.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = nil
+}
+
+// Fail makes the next call of method fail with description, as Telegram
+// answers with a 400 Bad Request. Failures queue up when called repeatedly.
+func (s *Server) Fail(method, description string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[method] = append(s.failures[method], description)
+}
+
+// AddAdmin makes getChatMember report userID as an administrator of every
+// chat. Other users are plain members.
+func (s *Server) AddAdmin(userID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.admins[userID] = true
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	// /bot<token>/<method>
+	path := strings.TrimPrefix(r.URL.Path, "/bot")
+	token, method, ok := strings.Cut(path, "/")
+	if !ok || token != Token {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	call, err := parseCall(method, r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Bad Request: "+err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	s.calls = append(s.calls, call)
+	var failure string
+	if queued := s.failures[method]; len(queued) > 0 {
+		failure, s.failures[method] = queued[0], queued[1:]
+	}
+	s.mu.Unlock()
+
+	if failure != "" {
+		writeError(w, http.StatusBadRequest, failure)
+		return
+	}
+
+	result, err := s.result(call)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Bad Request: "+err.Error())
+		return
+	}
+	writeResult(w, result)
+}
+
+// result answers call like Telegram would.
+func (s *Server) result(call Call) (any, error) {
+	chat := telego.Chat{ID: call.Int("chat_id"), Type: telego.ChatTypeGroup}
+	if chat.ID > 0 {
+		chat.Type = telego.ChatTypePrivate
+	}
+
+	switch call.Method {
+	case "getMe":
+		return telego.User{ID: 1234567890, IsBot: true, FirstName: "Thumb", Username: BotUsername}, nil
+	case "getChatMember":
+		s.mu.Lock()
+		admin := s.admins[call.Int("user_id")]
+		s.mu.Unlock()
+		user := telego.User{ID: call.Int("user_id")}
+		if admin {
+			return telego.ChatMemberAdministrator{Status: telego.MemberStatusAdministrator, User: user}, nil
+		}
+		return telego.ChatMemberMember{Status: telego.MemberStatusMember, User: user}, nil
+	case "sendMessage":
+		msg := s.message(chat)
+		msg.Text = call.Params["text"]
+		return msg, nil
+	case "sendPhoto", "sendVideo", "sendAudio":
+		kind := strings.ToLower(strings.TrimPrefix(call.Method, "send"))
+		msg := s.message(chat)
+		msg.Caption = call.Params["caption"]
+		attachMedia(&msg, kind)
+		return msg, nil
+	case "sendMediaGroup":
+		media, err := call.Media()
+		if err != nil {
+			return nil, fmt.Errorf("invalid media: %w", err)
+		}
+		messages := make([]telego.Message, 0, len(media))
+		for _, item := range media {
+			msg := s.message(chat)
+			msg.Caption = item.Caption
+			attachMedia(&msg, item.Type)
+			messages = append(messages, msg)
+		}
+		return messages, nil
+	}
+	// deleteMessage, setWebhook, deleteWebhook and the like
+	return true, nil
+}
+
+func (s *Server) message(chat telego.Chat) telego.Message {
+	s.mu.Lock()
+	s.messageID++
+	id := s.messageID
+	s.mu.Unlock()
+	return telego.Message{MessageID: id, Chat: chat, Date: time.Now().Unix()}
+}
+
+// attachMedia fills the media of kind in msg, with a file_id derived from
+// the message ID.
+func attachMedia(msg *telego.Message, kind string) {
+	fileID := fmt.Sprintf("%s-%d", kind, msg.MessageID)
+	switch kind {
+	case "photo":
+		msg.Photo = []telego.PhotoSize{{FileID: fileID + "-small"}, {FileID: fileID}}
+	case "video":
+		msg.Video = &telego.Video{FileID: fileID}
+	case "audio":
+		msg.Audio = &telego.Audio{FileID: fileID}
+	}
+}
+
+// parseCall reads the parameters of a JSON or multipart request.
+func parseCall(method string, r *http.Request) (Call, error) {
+	call := Call{Method: method, Params: make(map[string]string), Files: make(map[string]File)}
+
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil && r.ContentLength > 0 {
+		return call, err
+	}
+
+	switch mediaType {
+	case "multipart/form-data":
+		reader := multipart.NewReader(r.Body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return call, nil
+			}
+			if err != nil {
+				return call, err
+			}
+			data, err := io.ReadAll(part)
+			if err != nil {
+				return call, err
+			}
+			if part.FileName() != "" {
+				call.Files[part.FormName()] = File{Name: part.FileName(), Data: data}
+			} else {
+				call.Params[part.FormName()] = string(data)
+			}
+		}
+	case "application/json":
+		var raw map[string]json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+			return call, err
+		}
+		for key, value := range raw {
+			var str string
+			if json.Unmarshal(value, &str) == nil {
+				call.Params[key] = str
+			} else {
+				call.Params[key] = string(value)
+			}
+		}
+	}
+	return call, nil
+}
+
+func writeResult(w http.ResponseWriter, result any) {
+	raw, err := json.Marshal(result)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"ok": true, "result": json.RawMessage(raw)})
+}
+
+func writeError(w http.ResponseWriter, code int, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]any{"ok": false, "error_code": code, "description": description})
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+// Package integration holds what the platform clients in its subpackages
+// share.
+package integration
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Errors wrapped by the clients to tell why a post could not be fetched.
+var (
+	// ErrNotFound is for posts that do not exist or were deleted.
+	ErrNotFound = errors.New("post not found")
+	// ErrPrivate is for posts only visible to some users.
+	ErrPrivate = errors.New("post is private")
+	// ErrAgeRestricted is for posts hidden behind an age check.
+	ErrAgeRestricted = errors.New("post is age-restricted")
+	// ErrRateLimited is for requests the platform refused for their rate.
+	ErrRateLimited = errors.New("rate limited by the platform")
+	// ErrTooLarge is for media too large to send.
+	ErrTooLarge = errors.New("media is too large")
+	// ErrUnavailable is for platforms that are down or failing.
+	ErrUnavailable = errors.New("platform unavailable")
+)
+
+// StatusError maps the HTTP status of a failed response to the errors
+// above, returning nil for statuses it cannot tell anything from.
+func StatusError(status int) error {
+	switch {
+	case status == http.StatusNotFound || status == http.StatusGone:
+		return ErrNotFound
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return ErrPrivate
+	case status == http.StatusUnavailableForLegalReasons:
+		return ErrAgeRestricted
+	case status == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case status >= 500:
+		return ErrUnavailable
+	}
+	return nil
+}
+
+// WrapStatus returns an error for a failed response of host, wrapping
+// StatusError when the status tells why.
+func WrapStatus(host string, status int, detail string) error {
+	msg := fmt.Sprintf("%s returned status %d", host, status)
+	if detail != "" {
+		msg += ": " + detail
+	}
+	if err := StatusError(status); err != nil {
+		return fmt.Errorf("%w: %s", err, msg)
+	}
+	return errors.New(msg)
+}
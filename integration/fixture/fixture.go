@@ -0,0 +1,258 @@
+// Package fixture replays upstream responses recorded as JSON files so the
+// integrations can be tested offline.
+//
+// A fixture holds the exchanges of one test in the order they happened.
+// Replaying serves them back in that order, failing the test on any request
+// it does not expect. With RECORD_FIXTURES=1 set, Transport sends the
+// requests to the real upstream instead and rewrites the fixture with the
+// responses when the test passes. Fixtures written by hand are loaded with
+// Replay so record mode leaves them alone.
+package fixture
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"unicode/utf8"
+)
+
+// RecordEnv turns on record mode when set to 1.
+const RecordEnv = "RECORD_FIXTURES"
+
+// keptHeaders are the response headers saved with a fixture; the rest are
+// not needed to replay it and may identify the session that recorded it.
+var keptHeaders = []string{"Content-Type", "Content-Encoding", "Location", "Retry-After"}
+
+// Fixture is the file format: the exchanges of one test.
+type Fixture struct {
+	Exchanges []Exchange `json:"exchanges"`
+}
+
+// Exchange is one request and the response it got.
+type Exchange struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request identifies a request by method and URL.
+type Request struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+}
+
+// Response is a recorded response. Body holds text bodies and BodyBase64
+// binary ones.
+type Response struct {
+	Status     int                 `json:"status"`
+	Header     map[string][]string `json:"header,omitempty"`
+	Cookies    []string            `json:"cookies,omitempty"`
+	Body       string              `json:"body,omitempty"`
+	BodyBase64 string              `json:"body_base64,omitempty"`
+}
+
+// Recording reports whether record mode is on.
+func Recording() bool {
+	return os.Getenv(RecordEnv) == "1"
+}
+
+// Path is where the fixture called name is kept.
+func Path(name string) string {
+	return filepath.Join("testdata", name+".json")
+}
+
+// Transport replays the fixture called name, or records it in record mode.
+// Only the cookies named in keepCookies are saved.
+func Transport(t *testing.T, name string, keepCookies ...string) http.RoundTripper {
+	t.Helper()
+	if Recording() {
+		return record(t, name, keepCookies)
+	}
+	return Replay(t, name)
+}
+
+// Replay serves the fixture called name even in record mode, for fixtures
+// written by hand because the upstream cannot be made to answer them on
+// demand, such as rate limits and malformed bodies. Requests are matched by
+// method, path and query, so the fixture also replays against a client
+// pointed at another base URL.
+func Replay(t *testing.T, name string) http.RoundTripper {
+	t.Helper()
+
+	raw, err := os.ReadFile(Path(name))
+	if err != nil {
+		t.Fatalf("reading fixture: %v", err)
+	}
+	var f Fixture
+	if err := json.Unmarshal(raw, &f); err != nil {
+		t.Fatalf("parsing fixture %s: %v", name, err)
+	}
+
+	r := &replayer{t: t, name: name, exchanges: f.Exchanges}
+	t.Cleanup(func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if left := len(r.exchanges) - r.next; left > 0 {
+			t.Errorf("fixture %s: %d exchanges were not replayed, starting with %s %s",
+				name, left, r.exchanges[r.next].Request.Method, r.exchanges[r.next].Request.URL)
+		}
+	})
+	return r
+}
+
+type replayer struct {
+	t    *testing.T
+	name string
+
+	mu        sync.Mutex
+	exchanges []Exchange
+	next      int
+}
+
+func (r *replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.next >= len(r.exchanges) {
+		r.t.Errorf("fixture %s: unexpected request %s %s", r.name, req.Method, req.URL)
+		return nil, fmt.Errorf("fixture %s has no response for %s %s", r.name, req.Method, req.URL)
+	}
+	exchange := r.exchanges[r.next]
+	if !matches(exchange.Request, req) {
+		r.t.Errorf("fixture %s: got request %s %s, want %s %s",
+			r.name, req.Method, req.URL, exchange.Request.Method, exchange.Request.URL)
+		return nil, fmt.Errorf("fixture %s expected %s %s", r.name, exchange.Request.Method, exchange.Request.URL)
+	}
+	r.next++
+
+	return exchange.Response.toHTTP(req)
+}
+
+func matches(want Request, req *http.Request) bool {
+	if want.Method != req.Method {
+		return false
+	}
+	u, err := req.URL.Parse(want.URL)
+	if err != nil {
+		return false
+	}
+	return u.Path == req.URL.Path && u.RawQuery == req.URL.RawQuery
+}
+
+func (r Response) toHTTP(req *http.Request) (*http.Response, error) {
+	body := []byte(r.Body)
+	if r.BodyBase64 != "" {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(r.BodyBase64); err != nil {
+			return nil, fmt.Errorf("decoding fixture body: %w", err)
+		}
+	}
+
+	header := make(http.Header)
+	for key, values := range r.Header {
+		header[http.CanonicalHeaderKey(key)] = values
+	}
+	for _, cookie := range r.Cookies {
+		header.Add("Set-Cookie", cookie)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.Status, http.StatusText(r.Status)),
+		StatusCode:    r.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// recorder passes requests to the default transport and saves the exchanges
+// when the test ends.
+type recorder struct {
+	next        http.RoundTripper
+	keepCookies []string
+
+	mu        sync.Mutex
+	exchanges []Exchange
+}
+
+func record(t *testing.T, name string, keepCookies []string) http.RoundTripper {
+	r := &recorder{next: http.DefaultTransport, keepCookies: keepCookies}
+	t.Cleanup(func() {
+		// A failed test, e.g. one pointed at a post that no longer exists,
+		// keeps the fixture it had
+		if t.Failed() {
+			t.Logf("fixture %s not saved, the test failed", name)
+			return
+		}
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		raw, err := json.MarshalIndent(Fixture{Exchanges: r.exchanges}, "", "  ")
+		if err != nil {
+			t.Errorf("encoding fixture %s: %v", name, err)
+			return
+		}
+		if err := os.MkdirAll(filepath.Dir(Path(name)), 0o755); err != nil {
+			t.Errorf("saving fixture %s: %v", name, err)
+			return
+		}
+		if err := os.WriteFile(Path(name), append(raw, '\n'), 0o644); err != nil {
+			t.Errorf("saving fixture %s: %v", name, err)
+		}
+	})
+	return r
+}
+
+func (r *recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = io.NopCloser(bytes.NewReader(body))
+
+	recorded := Response{Status: res.StatusCode, Header: make(map[string][]string)}
+	for _, key := range keptHeaders {
+		if values := res.Header.Values(key); len(values) > 0 {
+			recorded.Header[key] = values
+		}
+	}
+	for _, cookie := range res.Cookies() {
+		for _, keep := range r.keepCookies {
+			if cookie.Name == keep {
+				recorded.Cookies = append(recorded.Cookies, cookie.Name+"="+cookie.Value)
+			}
+		}
+	}
+	if utf8.Valid(body) && res.Header.Get("Content-Encoding") == "" {
+		recorded.Body = string(body)
+	} else {
+		recorded.BodyBase64 = base64.StdEncoding.EncodeToString(body)
+	}
+
+	r.mu.Lock()
+	r.exchanges = append(r.exchanges, Exchange{
+		Request:  Request{Method: req.Method, URL: req.URL.String()},
+		Response: recorded,
+	})
+	r.mu.Unlock()
+	return res, nil
+}
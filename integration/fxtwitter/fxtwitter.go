@@ -1,11 +1,13 @@
 package fxtwitter
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
-	"sort"
+	"strings"
+	"thumb-bot/integration"
 )
 
 type Response struct {
@@ -101,14 +103,43 @@ type Variant struct {
 	Bitrate     *int   `json:"bitrate"`
 }
 
-func Fetch(status string) (Response, error) {
-	url := fmt.Sprintf("https://api.fxtwitter.com%s", status)
-	req, err := http.NewRequest("GET", url, nil)
+// DefaultBaseURL is the fxtwitter API the client calls unless told otherwise.
+const DefaultBaseURL = "https://api.fxtwitter.com"
+
+// Client calls the fxtwitter API.
+type Client struct {
+	http    *http.Client
+	baseURL string
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithBaseURL makes the client call baseURL, such as a self-hosted instance,
+// instead of DefaultBaseURL.
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		c.baseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+func NewClient(httpClient *http.Client, opts ...Option) *Client {
+	c := &Client{http: httpClient, baseURL: DefaultBaseURL}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Fetch returns the tweet at status, the path of a tweet URL.
+func (c *Client) Fetch(ctx context.Context, status string) (Response, error) {
+	url := c.baseURL + status
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return Response{}, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	res, err := http.DefaultClient.Do(req)
+	res, err := c.http.Do(req)
 	if err != nil {
 		return Response{}, fmt.Errorf("failed to fetch tweet: %w", err)
 	}
@@ -125,88 +156,19 @@ func Fetch(status string) (Response, error) {
 		return Response{}, fmt.Errorf("failed to unmarshal response body: %w", err)
 	}
 
-	if response.Code != 200 {
+	switch response.Code {
+	case 200:
+	case 404:
+		return Response{}, fmt.Errorf("%w: %s", integration.ErrNotFound, response.Message)
+	case 401:
+		return Response{}, fmt.Errorf("%w: %s", integration.ErrPrivate, response.Message)
+	case 429:
+		return Response{}, fmt.Errorf("%w: %s", integration.ErrRateLimited, response.Message)
+	case 500, 502, 503, 504:
+		return Response{}, fmt.Errorf("%w: %s", integration.ErrUnavailable, response.Message)
+	default:
 		return Response{}, fmt.Errorf("API error: %s", response.Message)
 	}
 
 	return response, nil
 }
-
-// EstimateFileSize estimates file size in bytes using bitrate and duration
-func EstimateFileSize(bitrate int, duration float64) int64 {
-	// Convert bitrate from bps to bytes per second
-	bytesPerSecond := int64(bitrate) / 8
-	// Calculate total size
-	return int64(duration * float64(bytesPerSecond))
-}
-
-// SelectBestVariant selects the best video variant under the size limit
-func SelectBestVariant(variants []Variant, duration float64, maxSizeBytes int64) (*Variant, bool) {
-	if len(variants) == 0 {
-		return nil, false
-	}
-
-	// Filter variants with bitrate information and estimate their sizes
-	var validVariants []struct {
-		variant *Variant
-		size    int64
-	}
-
-	for i := range variants {
-		if variants[i].Bitrate != nil {
-			size := EstimateFileSize(*variants[i].Bitrate, duration)
-			validVariants = append(validVariants, struct {
-				variant *Variant
-				size    int64
-			}{&variants[i], size})
-		}
-	}
-
-	if len(validVariants) == 0 {
-		return nil, false
-	}
-
-	// Sort by size (ascending) to get the largest variant under the limit
-	sort.Slice(validVariants, func(i, j int) bool {
-		return validVariants[i].size < validVariants[j].size
-	})
-
-	// Find the largest variant under the size limit
-	for i := len(validVariants) - 1; i >= 0; i-- {
-		if validVariants[i].size <= maxSizeBytes {
-			return validVariants[i].variant, true
-		}
-	}
-
-	// No variant fits under the limit
-	return nil, false
-}
-
-// GetBestMediaForTelegram selects the best media item for Telegram based on size constraints
-func GetBestMediaForTelegram(media MediaItem) (string, string, bool) {
-	const maxSizeBytes = 20 * 1024 * 1024 // 20MB
-
-	// For videos, try to find the best variant
-	if media.Type == "video" && len(media.Variants) > 0 {
-		bestVariant, found := SelectBestVariant(media.Variants, media.Duration, maxSizeBytes)
-		if found {
-			return bestVariant.URL, "video", true
-		}
-		// If no variant fits, fall back to thumbnail
-		if media.ThumbnailURL != "" {
-			return media.ThumbnailURL, "photo", true
-		}
-	}
-
-	// For photos or if no variants available, use the original URL
-	if media.Type == "photo" || media.Type == "image" {
-		return media.URL, "photo", true
-	}
-
-	// For videos without variants, use original URL (might exceed size limit)
-	if media.Type == "video" {
-		return media.URL, "video", true
-	}
-
-	return "", "", false
-}
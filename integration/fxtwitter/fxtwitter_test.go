@@ -0,0 +1,144 @@
+package fxtwitter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"thumb-bot/integration"
+	"thumb-bot/integration/fixture"
+	"thumb-bot/model"
+)
+
+func fetch(t *testing.T, transport http.RoundTripper, status string) (Response, error) {
+	t.Helper()
+	return NewClient(&http.Client{Transport: transport}).Fetch(context.Background(), status)
+}
+
+func TestFetchCarousel(t *testing.T) {
+	res, err := fetch(t, fixture.Transport(t, "carousel"), "/X/status/1765459901236785454")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	post := res.ToPost()
+	want := []model.MediaType{model.MediaPhoto, model.MediaPhoto, model.MediaVideo}
+	if len(post.Media) != len(want) {
+		t.Fatalf("got %d media, want %d", len(post.Media), len(want))
+	}
+	for i, media := range post.Media {
+		if media.Type != want[i] {
+			t.Errorf("media[%d] is a %s, want a %s", i, media.Type, want[i])
+		}
+		if media.URL == "" {
+			t.Errorf("media[%d] has no URL", i)
+		}
+	}
+	if post.Author.Username == "" || post.URL == "" {
+		t.Errorf("post is missing its author or URL: %+v", post)
+	}
+}
+
+func TestFetchVideoVariants(t *testing.T) {
+	res, err := fetch(t, fixture.Transport(t, "video"), "/X/status/1765459830287060992")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	post := res.ToPost()
+	if len(post.Media) != 1 || post.Media[0].Type != model.MediaVideo {
+		t.Fatalf("want a single video, got %+v", post.Media)
+	}
+	video := post.Media[0]
+	if video.Duration <= 0 || video.Thumbnail == "" {
+		t.Errorf("video is missing its duration or thumbnail: %+v", video)
+	}
+
+	var mp4 int
+	for _, v := range video.Variants {
+		if v.ContentType == "video/mp4" {
+			mp4++
+			if v.Bitrate <= 0 {
+				t.Errorf("mp4 variant %s has no bitrate", v.URL)
+			}
+		}
+	}
+	if mp4 < 2 {
+		t.Errorf("got %d mp4 variants, want several to choose from: %+v", mp4, video.Variants)
+	}
+	if !fixture.Recording() {
+		if !post.Sensitive {
+			t.Error("post should be marked sensitive")
+		}
+		if got := video.Duration; got != 31200*time.Millisecond {
+			t.Errorf("duration = %s", got)
+		}
+	}
+}
+
+func TestFetchTextOnly(t *testing.T) {
+	res, err := fetch(t, fixture.Transport(t, "text_only"), "/X/status/1765111420157034620")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	post := res.ToPost()
+	if len(post.Media) != 0 {
+		t.Errorf("got %d media, want none", len(post.Media))
+	}
+	if post.Text == "" {
+		t.Error("post has no text")
+	}
+}
+
+func TestFetchErrors(t *testing.T) {
+	tests := []struct {
+		fixture string
+		replay  bool
+		status  string
+		want    error
+	}{
+		{fixture: "private", replay: true, status: "/lockedaccount/status/1764000000000000001", want: integration.ErrPrivate},
+		{fixture: "rate_limited", replay: true, status: "/X/status/1765459901236785454", want: integration.ErrRateLimited},
+		{fixture: "malformed", replay: true, status: "/X/status/1765459901236785454"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			var transport http.RoundTripper
+			if tt.replay {
+				transport = fixture.Replay(t, tt.fixture)
+			} else {
+				transport = fixture.Transport(t, tt.fixture)
+			}
+
+			_, err := fetch(t, transport, tt.status)
+			if err == nil {
+				t.Fatal("want an error")
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestFetchFromBaseURL(t *testing.T) {
+	replay := fixture.Replay(t, "text_only")
+	transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Host != "fx.example.com" {
+			t.Errorf("request went to %s, want the configured base URL", req.URL.Host)
+		}
+		return replay.RoundTrip(req)
+	})
+
+	client := NewClient(&http.Client{Transport: transport}, WithBaseURL("https://fx.example.com/"))
+	if _, err := client.Fetch(context.Background(), "/X/status/1765111420157034620"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,61 @@
+package fxtwitter
+
+import (
+	"thumb-bot/model"
+	"thumb-bot/utils"
+	"time"
+)
+
+// ToPost maps the fxtwitter response into the shared post model.
+func (r Response) ToPost() model.Post {
+	tweet := r.Tweet
+	post := model.Post{
+		Source: "fxtwitter",
+		URL:    tweet.URL,
+		Author: model.Author{
+			Name:     tweet.Author.Name,
+			Username: tweet.Author.ScreenName,
+		},
+		Text: tweet.Text,
+		Stats: &model.Stats{
+			Likes:   tweet.Likes,
+			Reposts: tweet.Retweets,
+			Replies: tweet.Replies,
+			Views:   tweet.Views,
+		},
+		Sensitive: tweet.PossiblySensitive,
+	}
+
+	if tweet.Media == nil {
+		return post
+	}
+	for _, item := range tweet.Media.All {
+		media := model.Media{
+			URL:       utils.RemoveQueryParams(item.URL),
+			Width:     item.Width,
+			Height:    item.Height,
+			Duration:  time.Duration(item.Duration * float64(time.Second)),
+			Thumbnail: item.ThumbnailURL,
+		}
+		switch item.Type {
+		case "video":
+			media.Type = model.MediaVideo
+		case "photo", "image":
+			media.Type = model.MediaPhoto
+		default:
+			continue
+		}
+		for _, v := range item.Variants {
+			variant := model.Variant{
+				URL:         utils.RemoveQueryParams(v.URL),
+				ContentType: v.ContentType,
+			}
+			if v.Bitrate != nil {
+				variant.Bitrate = *v.Bitrate
+			}
+			media.Variants = append(media.Variants, variant)
+		}
+		post.Media = append(post.Media, media)
+	}
+	return post
+}
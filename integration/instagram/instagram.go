@@ -2,28 +2,24 @@ package instagram
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"math/rand"
 	"net/http"
-	"net/http/cookiejar"
 	"net/url"
 	"strconv"
 	"strings"
 	"sync"
+	"thumb-bot/infra/metrics"
+	"thumb-bot/integration"
 	"time"
 )
 
 // ===== Public types =====
 
-var (
-	csrfToken     string
-	csrfTokenExp  time.Time
-	csrfTokenLock = &sync.Mutex{}
-	cfg           = Config{Retries: 5, Delay: time.Second, MaxDelay: 30 * time.Second}
-)
-
 type InstagramResponse struct {
 	ResultsNumber int      `json:"results_number"`
 	URLList       []string `json:"url_list"`
@@ -52,18 +48,46 @@ type Dimensions struct {
 	Width  int `json:"width"`
 }
 
+// DefaultBaseURL serves the Instagram pages and GraphQL API.
+const DefaultBaseURL = "https://www.instagram.com"
+
 type Config struct {
+	// BaseURL replaces DefaultBaseURL when set.
+	BaseURL  string
 	Retries  int
 	Delay    time.Duration // initial delay between retries
 	MaxDelay time.Duration // maximum delay cap for exponential backoff
 }
 
+// Client fetches Instagram posts through the GraphQL API. It keeps the
+// session cookies and CSRF token between requests.
+type Client struct {
+	http *http.Client
+	cfg  Config
+
+	csrfTokenLock sync.Mutex
+	csrfToken     string
+	csrfTokenExp  time.Time
+}
+
+// NewClient expects httpClient to keep cookies.
+func NewClient(httpClient *http.Client, cfg Config) *Client {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = DefaultBaseURL
+	}
+	cfg.BaseURL = strings.TrimSuffix(cfg.BaseURL, "/")
+	return &Client{http: httpClient, cfg: cfg}
+}
+
 // ===== Internal structs (map the GraphQL JSON we need) =====
 
 type graphResponse struct {
 	Data struct {
 		ShortcodeMedia *node `json:"xdt_shortcode_media"`
 	} `json:"data"`
+	// RequireLogin is set instead of data for posts only followers see
+	RequireLogin bool   `json:"require_login"`
+	Message      string `json:"message"`
 }
 
 type node struct {
@@ -103,27 +127,21 @@ type edgesText struct {
 
 // ===== Public API =====
 
-func GetURL(inputURL string) (InstagramResponse, error) {
-
-	client, err := newHTTPClient()
-	if err != nil {
-		return InstagramResponse{}, err
-	}
-
+func (c *Client) GetURL(ctx context.Context, inputURL string) (InstagramResponse, error) {
 	// 1) Resolve share redirects if present
-	finalURL, err := checkRedirect(client, inputURL)
+	finalURL, err := c.checkRedirect(ctx, inputURL)
 	if err != nil {
 		return InstagramResponse{}, err
 	}
 
 	// 2) Extract shortcode
-	shortcode, err := getShortcode(finalURL)
+	shortcode, err := Shortcode(finalURL)
 	if err != nil {
 		return InstagramResponse{}, err
 	}
 
 	// 3) Fetch post via GraphQL (with retries/backoff)
-	post, err := instagramRequest(client, shortcode, cfg.Retries, cfg.Delay)
+	post, err := c.instagramRequest(ctx, shortcode, c.cfg.Retries, c.cfg.Delay)
 	if err != nil {
 		return InstagramResponse{}, err
 	}
@@ -185,26 +203,15 @@ func setGraphQLHeaders(req *http.Request, csrfToken string) {
 	req.Header.Set("Priority", "u=1, i")
 }
 
-func newHTTPClient() (*http.Client, error) {
-	jar, err := cookiejar.New(nil)
-	if err != nil {
-		return nil, err
-	}
-	return &http.Client{
-		Jar:     jar,
-		Timeout: 30 * time.Second,
-	}, nil
-}
-
-func checkRedirect(client *http.Client, u string) (string, error) {
+func (c *Client) checkRedirect(ctx context.Context, u string) (string, error) {
 	// Mimic the TS behavior: if URL contains "share", follow it and return the final URL
 	if strings.Contains(u, "/share/") || strings.Contains(u, "/share") {
-		req, err := http.NewRequest(http.MethodGet, u, nil)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
 		if err != nil {
 			return "", err
 		}
 		setBrowserHeaders(req)
-		resp, err := client.Do(req)
+		resp, err := c.http.Do(req)
 		if err != nil {
 			return "", err
 		}
@@ -215,7 +222,8 @@ func checkRedirect(client *http.Client, u string) (string, error) {
 	return u, nil
 }
 
-func getShortcode(u string) (string, error) {
+// Shortcode returns the post shortcode of a /p/, /reel/, /reels/ or /tv/ URL.
+func Shortcode(u string) (string, error) {
 	parts := strings.Split(u, "/")
 	tags := map[string]struct{}{"p": {}, "reel": {}, "tv": {}, "reels": {}}
 	for i, p := range parts {
@@ -230,38 +238,39 @@ func getShortcode(u string) (string, error) {
 }
 
 // invalidateCSRFToken clears the cached CSRF token, forcing a refresh on next request
-func invalidateCSRFToken() {
-	csrfTokenLock.Lock()
-	defer csrfTokenLock.Unlock()
-	csrfToken = ""
-	csrfTokenExp = time.Time{}
+func (c *Client) invalidateCSRFToken() {
+	c.csrfTokenLock.Lock()
+	defer c.csrfTokenLock.Unlock()
+	c.csrfToken = ""
+	c.csrfTokenExp = time.Time{}
 }
 
-func getCSRFToken(client *http.Client) (string, error) {
-	csrfTokenLock.Lock()
-	defer csrfTokenLock.Unlock()
+func (c *Client) getCSRFToken(ctx context.Context) (string, error) {
+	c.csrfTokenLock.Lock()
+	defer c.csrfTokenLock.Unlock()
 
 	// If in memory token is valid, return it
-	if csrfToken != "" && time.Now().Before(csrfTokenExp) {
-		return csrfToken, nil
+	if c.csrfToken != "" && time.Now().Before(c.csrfTokenExp) {
+		return c.csrfToken, nil
 	}
+	metrics.InstagramCSRFRefreshes.Inc()
 
-	req, err := http.NewRequest(http.MethodGet, "https://www.instagram.com/", nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.cfg.BaseURL+"/", nil)
 	if err != nil {
 		return "", err
 	}
 	setBrowserHeaders(req)
-	resp, err := client.Do(req)
+	resp, err := c.http.Do(req)
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
 
-	for _, c := range resp.Cookies() {
-		if c.Name == "csrftoken" && c.Value != "" {
-			csrfToken = c.Value
-			csrfTokenExp = time.Now().Add(10 * time.Minute) // cache por 10 minutos
-			return csrfToken, nil
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "csrftoken" && cookie.Value != "" {
+			c.csrfToken = cookie.Value
+			c.csrfTokenExp = time.Now().Add(10 * time.Minute) // cache por 10 minutos
+			return c.csrfToken, nil
 		}
 	}
 	// Fallback: busca no header
@@ -274,9 +283,9 @@ func getCSRFToken(client *http.Client) (string, error) {
 					val = raw[len("csrftoken="):semi]
 				}
 				if val != "" {
-					csrfToken = val
-					csrfTokenExp = time.Now().Add(10 * time.Minute)
-					return csrfToken, nil
+					c.csrfToken = val
+					c.csrfTokenExp = time.Now().Add(10 * time.Minute)
+					return c.csrfToken, nil
 				}
 			}
 		}
@@ -284,12 +293,11 @@ func getCSRFToken(client *http.Client) (string, error) {
 	return "", errors.New("CSRF token not found in response headers")
 }
 
-func instagramRequest(client *http.Client, shortcode string, retries int, delay time.Duration) (*node, error) {
-	const baseURL = "https://www.instagram.com/graphql/query"
+func (c *Client) instagramRequest(ctx context.Context, shortcode string, retries int, delay time.Duration) (*node, error) {
 	const docID = "9510064595728286"
 
 	// 1) CSRF token
-	token, err := getCSRFToken(client)
+	token, err := c.getCSRFToken(ctx)
 	if err != nil {
 		return nil, wrapErr("failed to obtain CSRF", err)
 	}
@@ -310,13 +318,13 @@ func instagramRequest(client *http.Client, shortcode string, retries int, delay
 	form.Set("variables", string(varJSON))
 	form.Set("doc_id", docID)
 
-	req, err := http.NewRequest(http.MethodPost, baseURL, bytes.NewBufferString(form.Encode()))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.BaseURL+"/graphql/query", bytes.NewBufferString(form.Encode()))
 	if err != nil {
 		return nil, err
 	}
 	setGraphQLHeaders(req, token)
 
-	resp, err := client.Do(req)
+	resp, err := c.http.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -325,8 +333,10 @@ func instagramRequest(client *http.Client, shortcode string, retries int, delay
 	// Retry on 429 / 403 like TS code
 	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusUnauthorized {
 		if retries > 0 {
+			metrics.InstagramRetries.Inc()
+
 			// Invalidate CSRF token so we get a fresh one on retry
-			invalidateCSRFToken()
+			c.invalidateCSRFToken()
 
 			wait := delay
 			if ra := resp.Header.Get("Retry-After"); ra != "" {
@@ -340,36 +350,55 @@ func instagramRequest(client *http.Client, shortcode string, retries int, delay
 			wait += jitter
 
 			// Cap the delay to prevent excessively long waits
-			if wait > cfg.MaxDelay {
-				wait = cfg.MaxDelay
+			if wait > c.cfg.MaxDelay {
+				wait = c.cfg.MaxDelay
 			}
 
-			time.Sleep(wait)
+			// Give up waiting when the update is cancelled or times out
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, ctx.Err()
+			}
 
 			// Exponential backoff on the "delay" path
 			nextDelay := delay * 2
-			if nextDelay > cfg.MaxDelay {
-				nextDelay = cfg.MaxDelay
+			if nextDelay > c.cfg.MaxDelay {
+				nextDelay = c.cfg.MaxDelay
 			}
-			return instagramRequest(client, shortcode, retries-1, nextDelay)
+			return c.instagramRequest(ctx, shortcode, retries-1, nextDelay)
 		}
 		b, _ := io.ReadAll(resp.Body)
-		return nil, errors.New("failed instagram request after retries: " + string(b))
+		// Instagram answers throttled clients with 401 and 403 as well
+		return nil, fmt.Errorf("%w: failed instagram request after retries: %s", integration.ErrRateLimited, b)
 	}
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		b, _ := io.ReadAll(resp.Body)
-		return nil, errors.New("failed instagram request: " + resp.Status + " - " + string(b))
+		return nil, integration.WrapStatus("instagram", resp.StatusCode, string(b))
+	}
+	// Anonymous requests for private posts may be sent to the login page
+	if strings.HasPrefix(resp.Request.URL.Path, "/accounts/login") {
+		return nil, fmt.Errorf("%w: instagram asked to log in", integration.ErrPrivate)
 	}
 
 	var gr graphResponse
 	if err := json.NewDecoder(resp.Body).Decode(&gr); err != nil {
 		return nil, err
 	}
-	if gr.Data.ShortcodeMedia == nil {
-		return nil, errors.New("only posts/reels supported, check if your link is valid")
+	if gr.RequireLogin {
+		return nil, fmt.Errorf("%w: instagram asked to log in: %s", integration.ErrPrivate, gr.Message)
+	}
+	media := gr.Data.ShortcodeMedia
+	if media == nil {
+		return nil, fmt.Errorf("%w: only posts/reels supported, check if your link is valid", integration.ErrNotFound)
+	}
+	if media.Owner.IsPrivate && media.DisplayURL == "" && media.VideoURL == "" && len(media.EdgeSidecarToChildren.Edges) == 0 {
+		return nil, fmt.Errorf("%w: the account is private", integration.ErrPrivate)
 	}
-	return gr.Data.ShortcodeMedia, nil
+	return media, nil
 }
 
 func createOutputData(n *node) (InstagramResponse, error) {
@@ -454,7 +483,8 @@ func wrapErr(msg string, err error) error {
 Example usage:
 
 func main() {
-	resp, err := InstagramGetURL("https://www.instagram.com/p/SHORTCODE/", &Config{Retries: 5, Delay: time.Second})
+	client := NewClient(factory.Client("instagram", httpclient.WithCookies()), Config{Retries: 5, Delay: time.Second, MaxDelay: 30 * time.Second})
+	resp, err := client.GetURL(context.Background(), "https://www.instagram.com/p/SHORTCODE/")
 	if err != nil {
 		log.Fatal(err)
 	}
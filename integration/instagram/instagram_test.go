@@ -0,0 +1,115 @@
+package instagram
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"thumb-bot/integration"
+	"thumb-bot/integration/fixture"
+	"thumb-bot/model"
+)
+
+// getURL fetches postURL retrying twice, without waiting between attempts.
+func getURL(t *testing.T, transport http.RoundTripper, postURL string) (InstagramResponse, error) {
+	t.Helper()
+	client := NewClient(&http.Client{Transport: transport}, Config{
+		Retries:  2,
+		Delay:    time.Millisecond,
+		MaxDelay: time.Millisecond,
+	})
+	return client.GetURL(context.Background(), postURL)
+}
+
+func TestGetURLCarousel(t *testing.T) {
+	res, err := getURL(t, fixture.Transport(t, "carousel", "csrftoken"), "https://www.instagram.com/p/C4NvZ8Aui3X/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	post := res.ToPost("https://www.instagram.com/p/C4NvZ8Aui3X/")
+	if len(post.Media) < 2 {
+		t.Fatalf("got %d media, want every item of the carousel", len(post.Media))
+	}
+	if res.ResultsNumber != len(res.URLList) || len(res.URLList) != len(post.Media) {
+		t.Errorf("results_number %d, url_list %d and media %d disagree", res.ResultsNumber, len(res.URLList), len(post.Media))
+	}
+	for i, media := range post.Media {
+		if media.URL == "" {
+			t.Errorf("media[%d] has no URL", i)
+		}
+		if media.Type == model.MediaVideo && media.Thumbnail == "" {
+			t.Errorf("video %d has no thumbnail", i)
+		}
+	}
+	if !fixture.Recording() {
+		want := []model.MediaType{model.MediaPhoto, model.MediaPhoto, model.MediaVideo}
+		for i, media := range post.Media {
+			if media.Type != want[i] {
+				t.Errorf("media[%d] is a %s, want a %s", i, media.Type, want[i])
+			}
+		}
+	}
+	if post.Author.Username == "" {
+		t.Error("post has no author")
+	}
+}
+
+func TestGetURLReel(t *testing.T) {
+	res, err := getURL(t, fixture.Transport(t, "reel", "csrftoken"), "https://www.instagram.com/reel/C4PqL2sRk9m/?igsh=abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	post := res.ToPost("https://www.instagram.com/reel/C4PqL2sRk9m/")
+	if len(post.Media) != 1 || post.Media[0].Type != model.MediaVideo {
+		t.Fatalf("want a single video, got %+v", post.Media)
+	}
+	if post.Media[0].Thumbnail == "" {
+		t.Error("video has no thumbnail")
+	}
+}
+
+func TestGetURLRetriesWhenRateLimited(t *testing.T) {
+	res, err := getURL(t, fixture.Replay(t, "retry"), "https://www.instagram.com/reel/C4PqL2sRk9m/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.MediaDetails) != 1 {
+		t.Errorf("got %d media, want the reel", len(res.MediaDetails))
+	}
+}
+
+func TestGetURLErrors(t *testing.T) {
+	tests := []struct {
+		fixture string
+		replay  bool
+		want    error
+	}{
+		{fixture: "not_found", want: integration.ErrNotFound},
+		{fixture: "private", replay: true, want: integration.ErrPrivate},
+		{fixture: "private_owner", replay: true, want: integration.ErrPrivate},
+		{fixture: "rate_limited", replay: true, want: integration.ErrRateLimited},
+		{fixture: "malformed", replay: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			var transport http.RoundTripper
+			if tt.replay {
+				transport = fixture.Replay(t, tt.fixture)
+			} else {
+				transport = fixture.Transport(t, tt.fixture, "csrftoken")
+			}
+
+			_, err := getURL(t, transport, "https://www.instagram.com/p/C3xYz0aLmNo/")
+			if err == nil {
+				t.Fatal("want an error")
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
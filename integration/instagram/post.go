@@ -0,0 +1,38 @@
+package instagram
+
+import "thumb-bot/model"
+
+// ToPost maps the Instagram response into the shared post model. Like counts
+// are hidden on many posts, so no stats are attached.
+func (r InstagramResponse) ToPost(postURL string) model.Post {
+	post := model.Post{
+		Source: "instagram",
+		URL:    postURL,
+		Author: model.Author{
+			Name:     r.PostInfo.OwnerFullname,
+			Username: r.PostInfo.OwnerUsername,
+		},
+		Text: r.PostInfo.Caption,
+	}
+
+	for _, detail := range r.MediaDetails {
+		media := model.Media{
+			URL:    detail.URL,
+			Width:  detail.Dimensions.Width,
+			Height: detail.Dimensions.Height,
+		}
+		switch detail.Type {
+		case "video":
+			media.Type = model.MediaVideo
+			if detail.Thumbnail != nil {
+				media.Thumbnail = *detail.Thumbnail
+			}
+		case "image":
+			media.Type = model.MediaPhoto
+		default:
+			continue
+		}
+		post.Media = append(post.Media, media)
+	}
+	return post
+}
@@ -0,0 +1,18 @@
+package vocaroo
+
+import "thumb-bot/model"
+
+// ToPost maps the recording into the shared post model as a single audio
+// uploaded from memory.
+func (r Recording) ToPost(postURL string) model.Post {
+	return model.Post{
+		Source: "vocaroo",
+		URL:    postURL,
+		Media: []model.Media{{
+			Type:     model.MediaAudio,
+			Title:    r.Title,
+			FileName: r.ShortCode + ".mp3",
+			Data:     r.Data,
+		}},
+	}
+}
@@ -2,65 +2,134 @@ package vocaroo
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"strings"
+	"thumb-bot/integration"
 	"thumb-bot/utils"
 )
 
-func Fetch(url string) (io.Reader, string, error) {
-	shortCode, err := getShortcode(url)
+// MaxSize is the largest recording downloaded, matching the size Telegram
+// accepts for files uploaded by bots.
+const MaxSize = 50 * 1024 * 1024
+
+var (
+	// ErrExpired is returned for recordings Vocaroo no longer serves.
+	ErrExpired = fmt.Errorf("vocaroo recording has expired or was deleted: %w", integration.ErrNotFound)
+	// ErrTooLarge is returned for recordings over MaxSize.
+	ErrTooLarge = fmt.Errorf("vocaroo recording is too large to upload: %w", integration.ErrTooLarge)
+)
+
+// Recording is a downloaded Vocaroo recording.
+type Recording struct {
+	ShortCode string
+	Title     string
+	Data      []byte
+}
+
+// DefaultBaseURL serves the Vocaroo MP3 files.
+const DefaultBaseURL = "https://media1.vocaroo.com"
+
+// Client downloads Vocaroo recordings.
+type Client struct {
+	http    *http.Client
+	baseURL string
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithBaseURL makes the client download the MP3 files from baseURL instead
+// of DefaultBaseURL.
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		c.baseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+// NewClient expects httpClient to accept bodies of MaxSize bytes.
+func NewClient(httpClient *http.Client, opts ...Option) *Client {
+	c := &Client{http: httpClient, baseURL: DefaultBaseURL}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Fetch resolves the shortcode of url and downloads the MP3 into memory.
+func (c *Client) Fetch(ctx context.Context, url string) (*Recording, error) {
+	shortCode, err := Shortcode(url)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
 
-	downloadUrl := fmt.Sprintf("https://media1.vocaroo.com/mp3/%s", shortCode)
+	downloadUrl := fmt.Sprintf("%s/mp3/%s", c.baseURL, shortCode)
 
-	reader, err := getMP3Reader(downloadUrl)
+	data, err := c.getMP3(ctx, downloadUrl)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
 
-	return reader, fmt.Sprintf("Vocaroo %s", shortCode), nil
+	return &Recording{
+		ShortCode: shortCode,
+		Title:     fmt.Sprintf("Vocaroo %s", shortCode),
+		Data:      data,
+	}, nil
 }
 
-func getShortcode(urlStr string) (string, error) {
+// Shortcode returns the recording shortcode, the first segment of the path.
+func Shortcode(urlStr string) (string, error) {
 	u, err := url.Parse(utils.RemoveQueryParams(urlStr))
 	if err != nil {
 		return "", err
 	}
 	path := strings.Split(u.Path, "/")
-	if len(path) < 2 {
+	if len(path) < 2 || path[1] == "" {
 		return "", errors.New("invalid url")
 	}
 	return path[1], nil
 }
 
-func getMP3Reader(url string) (io.Reader, error) {
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", url, nil)
+func (c *Client) getMP3(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Set("Referer", "https://vocaroo.com/")
-	resp, err := client.Do(req)
+	resp, err := c.http.Do(req)
+	if errors.Is(err, integration.ErrTooLarge) {
+		// The client refused a response declaring a larger size
+		return nil, ErrTooLarge
+	}
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to fetch MP3: %s", resp.Status)
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return nil, ErrExpired
+	case resp.StatusCode != http.StatusOK:
+		return nil, integration.WrapStatus("vocaroo", resp.StatusCode, "failed to fetch MP3")
+	case resp.ContentLength > MaxSize:
+		return nil, ErrTooLarge
 	}
 
 	buf := new(bytes.Buffer)
-	_, err = io.Copy(buf, resp.Body)
-	if err != nil {
+	// Read one byte past the limit to tell a full-size file from a larger one
+	if _, err := io.Copy(buf, io.LimitReader(resp.Body, MaxSize+1)); err != nil {
 		return nil, err
 	}
+	if buf.Len() > MaxSize {
+		return nil, ErrTooLarge
+	}
+	if buf.Len() == 0 {
+		return nil, ErrExpired
+	}
 
-	return buf, nil
+	return buf.Bytes(), nil
 }
@@ -0,0 +1,59 @@
+package vocaroo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"thumb-bot/integration"
+	"thumb-bot/integration/fixture"
+)
+
+func fetch(t *testing.T, transport http.RoundTripper, url string) (*Recording, error) {
+	t.Helper()
+	return NewClient(&http.Client{Transport: transport}).Fetch(context.Background(), url)
+}
+
+func TestFetchRecording(t *testing.T) {
+	rec, err := fetch(t, fixture.Transport(t, "recording"), "https://voca.ro/1o2Kxa7vQ9fB")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rec.ShortCode != "1o2Kxa7vQ9fB" {
+		t.Errorf("shortcode = %q", rec.ShortCode)
+	}
+	// MP3 files start with an ID3 tag or a frame sync
+	if !bytes.HasPrefix(rec.Data, []byte("ID3")) && !bytes.HasPrefix(rec.Data, []byte{0xff}) {
+		t.Errorf("data does not look like an MP3: % x", rec.Data[:min(len(rec.Data), 8)])
+	}
+}
+
+func TestFetchErrors(t *testing.T) {
+	tests := []struct {
+		fixture string
+		replay  bool
+		url     string
+		want    error
+	}{
+		{fixture: "expired", url: "https://vocaroo.com/1aBcDeFgHiJk", want: ErrExpired},
+		{fixture: "rate_limited", replay: true, url: "https://voca.ro/1o2Kxa7vQ9fB", want: integration.ErrRateLimited},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			var transport http.RoundTripper
+			if tt.replay {
+				transport = fixture.Replay(t, tt.fixture)
+			} else {
+				transport = fixture.Transport(t, tt.fixture)
+			}
+
+			_, err := fetch(t, transport, tt.url)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
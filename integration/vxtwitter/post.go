@@ -0,0 +1,46 @@
+package vxtwitter
+
+import (
+	"thumb-bot/model"
+	"thumb-bot/utils"
+	"time"
+)
+
+// ToPost maps the vxtwitter response into the shared post model.
+func (r Response) ToPost() model.Post {
+	post := model.Post{
+		Source: "vxtwitter",
+		URL:    r.TweetURL,
+		Author: model.Author{
+			Name:     r.UserName,
+			Username: r.UserScreenName,
+		},
+		Text: r.Text,
+		Stats: &model.Stats{
+			Likes:   r.Likes,
+			Reposts: r.Retweets,
+			Replies: r.Replies,
+		},
+		Sensitive: r.PossiblySensitive,
+	}
+
+	for _, item := range r.MediaExtended {
+		media := model.Media{
+			URL:       utils.RemoveQueryParams(item.URL),
+			Width:     item.Size.Width,
+			Height:    item.Size.Height,
+			Duration:  time.Duration(item.DurationMillis) * time.Millisecond,
+			Thumbnail: item.ThumbnailURL,
+		}
+		switch item.Type {
+		case "video":
+			media.Type = model.MediaVideo
+		case "image":
+			media.Type = model.MediaPhoto
+		default:
+			continue
+		}
+		post.Media = append(post.Media, media)
+	}
+	return post
+}
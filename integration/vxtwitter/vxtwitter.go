@@ -1,10 +1,13 @@
 package vxtwitter
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
+	"thumb-bot/integration"
 )
 
 type Response struct {
@@ -36,19 +39,54 @@ type Response struct {
 	UserScreenName    string `json:"user_screen_name"`
 }
 
-func Fetch(status string) (Response, error) {
-	url := fmt.Sprintf("https://api.vxtwitter.com%s", status)
-	req, err := http.NewRequest("GET", url, nil)
+// DefaultBaseURL is the vxtwitter API the client calls unless told otherwise.
+const DefaultBaseURL = "https://api.vxtwitter.com"
+
+// Client calls the vxtwitter API.
+type Client struct {
+	http    *http.Client
+	baseURL string
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithBaseURL makes the client call baseURL, such as a self-hosted instance,
+// instead of DefaultBaseURL.
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		c.baseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+func NewClient(httpClient *http.Client, opts ...Option) *Client {
+	c := &Client{http: httpClient, baseURL: DefaultBaseURL}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Fetch returns the tweet at status, the path of a tweet URL.
+func (c *Client) Fetch(ctx context.Context, status string) (Response, error) {
+	url := c.baseURL + status
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return Response{}, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	res, err := http.DefaultClient.Do(req)
+	res, err := c.http.Do(req)
 	if err != nil {
 		return Response{}, fmt.Errorf("failed to fetch tweet: %w", err)
 	}
 	defer res.Body.Close()
 
+	switch res.StatusCode {
+	case http.StatusOK:
+	default:
+		return Response{}, integration.WrapStatus("vxtwitter API", res.StatusCode, "")
+	}
+
 	body, err := io.ReadAll(res.Body)
 	if err != nil {
 		return Response{}, fmt.Errorf("failed to read response body: %w", err)
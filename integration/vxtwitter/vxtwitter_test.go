@@ -0,0 +1,84 @@
+package vxtwitter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"thumb-bot/integration"
+	"thumb-bot/integration/fixture"
+	"thumb-bot/model"
+)
+
+func fetch(t *testing.T, transport http.RoundTripper, status string) (Response, error) {
+	t.Helper()
+	return NewClient(&http.Client{Transport: transport}).Fetch(context.Background(), status)
+}
+
+func TestFetchCarousel(t *testing.T) {
+	res, err := fetch(t, fixture.Transport(t, "carousel"), "/X/status/1765459901236785454")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	post := res.ToPost()
+	want := []model.MediaType{model.MediaPhoto, model.MediaVideo}
+	if len(post.Media) != len(want) {
+		t.Fatalf("got %d media, want %d", len(post.Media), len(want))
+	}
+	for i, media := range post.Media {
+		if media.Type != want[i] {
+			t.Errorf("media[%d] is a %s, want a %s", i, media.Type, want[i])
+		}
+	}
+	if video := post.Media[1]; video.Duration <= 0 || video.Thumbnail == "" {
+		t.Errorf("video is missing its duration or thumbnail: %+v", video)
+	}
+}
+
+func TestFetchTextOnly(t *testing.T) {
+	res, err := fetch(t, fixture.Transport(t, "text_only"), "/X/status/1765111420157034620")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	post := res.ToPost()
+	if len(post.Media) != 0 {
+		t.Errorf("got %d media, want none", len(post.Media))
+	}
+	if post.Text == "" {
+		t.Error("post has no text")
+	}
+}
+
+func TestFetchErrors(t *testing.T) {
+	tests := []struct {
+		fixture string
+		replay  bool
+		status  string
+		want    error
+	}{
+		{fixture: "private", replay: true, status: "/lockedaccount/status/1764000000000000001", want: integration.ErrPrivate},
+		{fixture: "rate_limited", replay: true, status: "/X/status/1765459901236785454", want: integration.ErrRateLimited},
+		{fixture: "malformed", replay: true, status: "/X/status/1765459901236785454"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			var transport http.RoundTripper
+			if tt.replay {
+				transport = fixture.Replay(t, tt.fixture)
+			} else {
+				transport = fixture.Transport(t, tt.fixture)
+			}
+
+			_, err := fetch(t, transport, tt.status)
+			if err == nil {
+				t.Fatal("want an error")
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package youtube
+
+import "thumb-bot/model"
+
+// ToPost maps the oEmbed response into the shared post model, using the
+// thumbnail as the post's only media.
+func (r YouTubeResponse) ToPost(directLink string) model.Post {
+	post := model.Post{
+		Source: "youtube",
+		URL:    directLink,
+		Author: model.Author{Name: r.AuthorName},
+		Text:   r.Title,
+	}
+
+	if r.ThumbnailURL != "" {
+		post.Media = append(post.Media, model.Media{
+			Type:   model.MediaPhoto,
+			URL:    r.ThumbnailURL,
+			Width:  r.ThumbnailWidth,
+			Height: r.ThumbnailHeight,
+		})
+	}
+	return post
+}
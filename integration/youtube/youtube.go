@@ -1,6 +1,7 @@
 package youtube
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,7 +10,7 @@ import (
 	"net/url"
 	"regexp"
 	"strings"
-	"time"
+	"thumb-bot/integration"
 )
 
 // ExtractVideoID extracts the video ID from various YouTube URL formats
@@ -66,8 +67,36 @@ func ExtractVideoID(youtubeURL string) (string, error) {
 	return "", errors.New("could not extract video ID from URL")
 }
 
+// DefaultBaseURL serves the YouTube oEmbed API.
+const DefaultBaseURL = "https://www.youtube.com"
+
+// Client calls the YouTube oEmbed API.
+type Client struct {
+	http    *http.Client
+	baseURL string
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithBaseURL makes the client call the oEmbed API at baseURL instead of
+// DefaultBaseURL.
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		c.baseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+func NewClient(httpClient *http.Client, opts ...Option) *Client {
+	c := &Client{http: httpClient, baseURL: DefaultBaseURL}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
 // Fetch retrieves YouTube video information using oEmbed API
-func Fetch(youtubeURL string) (YouTubeResponse, error) {
+func (c *Client) Fetch(ctx context.Context, youtubeURL string) (YouTubeResponse, error) {
 	videoID, err := ExtractVideoID(youtubeURL)
 	if err != nil {
 		return YouTubeResponse{}, fmt.Errorf("failed to extract video ID: %w", err)
@@ -77,21 +106,25 @@ func Fetch(youtubeURL string) (YouTubeResponse, error) {
 	normalizedURL := fmt.Sprintf("https://www.youtube.com/watch?v=%s", videoID)
 
 	// YouTube oEmbed API endpoint
-	oEmbedURL := fmt.Sprintf("https://www.youtube.com/oembed?url=%s&format=json", url.QueryEscape(normalizedURL))
+	oEmbedURL := fmt.Sprintf("%s/oembed?url=%s&format=json", c.baseURL, url.QueryEscape(normalizedURL))
 
-	client := &http.Client{
-		Timeout: 30 * time.Second,
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, oEmbedURL, nil)
+	if err != nil {
+		return YouTubeResponse{}, fmt.Errorf("failed to create request: %w", err)
 	}
-
-	resp, err := client.Get(oEmbedURL)
+	resp, err := c.http.Do(req)
 	if err != nil {
 		return YouTubeResponse{}, fmt.Errorf("failed to fetch YouTube data: %w", err)
 	}
 	defer resp.Body.Close()
 
+	// oEmbed answers 400 for IDs that do not exist
+	if resp.StatusCode == http.StatusBadRequest {
+		return YouTubeResponse{}, fmt.Errorf("%w: YouTube API returned status %d", integration.ErrNotFound, resp.StatusCode)
+	}
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return YouTubeResponse{}, fmt.Errorf("YouTube API returned status %d: %s", resp.StatusCode, string(body))
+		return YouTubeResponse{}, integration.WrapStatus("YouTube API", resp.StatusCode, string(body))
 	}
 
 	var response YouTubeResponse
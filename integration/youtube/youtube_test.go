@@ -0,0 +1,64 @@
+package youtube
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"thumb-bot/integration"
+	"thumb-bot/integration/fixture"
+	"thumb-bot/model"
+)
+
+func fetch(t *testing.T, transport http.RoundTripper, videoURL string) (YouTubeResponse, error) {
+	t.Helper()
+	return NewClient(&http.Client{Transport: transport}).Fetch(context.Background(), videoURL)
+}
+
+func TestFetchVideo(t *testing.T) {
+	res, err := fetch(t, fixture.Transport(t, "video"), "https://youtu.be/dQw4w9WgXcQ?si=abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	post := res.ToPost("https://www.youtube.com/watch?v=dQw4w9WgXcQ")
+	if post.Text == "" || post.Author.Name == "" {
+		t.Errorf("post is missing its title or author: %+v", post)
+	}
+	if len(post.Media) != 1 || post.Media[0].Type != model.MediaPhoto || post.Media[0].URL == "" {
+		t.Errorf("want the thumbnail as the only photo, got %+v", post.Media)
+	}
+}
+
+func TestFetchErrors(t *testing.T) {
+	tests := []struct {
+		fixture string
+		replay  bool
+		url     string
+		want    error
+	}{
+		{fixture: "not_found", url: "https://www.youtube.com/watch?v=aaaaaaaaaaa", want: integration.ErrNotFound},
+		{fixture: "private", replay: true, url: "https://www.youtube.com/watch?v=bbbbbbbbbbb", want: integration.ErrPrivate},
+		{fixture: "rate_limited", replay: true, url: "https://www.youtube.com/watch?v=dQw4w9WgXcQ", want: integration.ErrRateLimited},
+		{fixture: "malformed", replay: true, url: "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			var transport http.RoundTripper
+			if tt.replay {
+				transport = fixture.Replay(t, tt.fixture)
+			} else {
+				transport = fixture.Transport(t, tt.fixture)
+			}
+
+			_, err := fetch(t, transport, tt.url)
+			if err == nil {
+				t.Fatal("want an error")
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -2,48 +2,86 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
+	"thumb-bot/access"
+	"thumb-bot/admin"
+	"thumb-bot/config"
+	"thumb-bot/filecache"
 	"thumb-bot/infra/logs"
+	"thumb-bot/infra/metrics"
+	"thumb-bot/infra/queue"
+	"thumb-bot/infra/storage"
+	"thumb-bot/infra/tracing"
 	"thumb-bot/service"
+	"thumb-bot/settings"
 	"thumb-bot/webhook"
 	"time"
 
+	"github.com/gofiber/adaptor/v2"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/mymmrac/telego"
+	"github.com/mymmrac/telego/telegoapi"
 	"go.uber.org/zap"
-	"go.uber.org/zap/zapcore"
 )
 
 func main() {
+	// Load configuration from CONFIG_FILE (or config/config.json) and the environment
+	cfg, err := config.Load(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
 	// Initialize logger
-	logger := logs.NewLogger(zapcore.InfoLevel)
+	logger, logLevel := logs.NewLogger(cfg.Logging())
 	defer logger.Sync()
+	for _, warning := range cfg.Warnings {
+		logger.Warn(warning)
+	}
 
-	// Get bot token from environment variable
-	token := os.Getenv("TELEGRAM_TOKEN")
-	if token == "" {
-		logger.Fatal("TELEGRAM_TOKEN environment variable is not set")
+	// Export traces when an OTLP endpoint is configured
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config(cfg.Tracing))
+	if err != nil {
+		logger.Fatal("failed to set up tracing", zap.Error(err))
 	}
 
 	// Initialize bot with token
-	bot, err := telego.NewBot(token)
+	bot, err := telego.NewBot(cfg.TelegramToken, telego.WithAPICaller(metrics.NewTelegramCaller(telegoapi.DefaultFastHTTPCaller)))
 	if err != nil {
 		logger.Fatal("failed to create bot", zap.Error(err))
 	}
 
+	// Open the embedded database holding per-chat settings and access lists
+	db, err := storage.Open(cfg.DBPath)
+	if err != nil {
+		logger.Fatal("failed to open database", zap.Error(err))
+	}
+	defer db.Close()
+
 	// Create service
-	telegramService := service.NewTelegramService(logger, bot)
+	opts := []service.Option{
+		service.WithSettingsStore(settings.NewBoltStore(db)),
+		service.WithAccessStore(access.NewBoltStore(db)),
+	}
+	if cfg.FileCache.Persistent {
+		opts = append(opts, service.WithFileCache(filecache.NewBoltStore(db, cfg.FileCache.TTL.Std(), cfg.FileCache.MaxEntries)))
+	}
+	telegramService := service.NewTelegramService(logger, bot, cfg, opts...)
 
 	// Create webhook handler
-	webhookHandler := webhook.NewWebhookHandler(logger, bot, telegramService)
+	webhookHandler := webhook.NewWebhookHandler(logger, bot, telegramService, cfg.Webhook.Secret)
 
 	// Create Fiber app
 	app := fiber.New(fiber.Config{
 		DisableStartupMessage: false,
+		ReadTimeout:           cfg.HTTP.ReadTimeout.Std(),
+		WriteTimeout:          cfg.HTTP.WriteTimeout.Std(),
+		IdleTimeout:           cfg.HTTP.IdleTimeout.Std(),
 	})
 
 	// Add middleware
@@ -53,17 +91,59 @@ func main() {
 	// Health check endpoint
 	app.Get("/health", func(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{
-			"status":    "ok",
-			"timestamp": time.Now().Unix(),
+			"status":         "ok",
+			"timestamp":      time.Now().Unix(),
+			"provider_cache": telegramService.CacheStats(),
 		})
 	})
 
-	// Webhook endpoint
-	app.Post("/webhook", webhookHandler.HandleWebhook)
+	// Prometheus metrics endpoint
+	metrics.RegisterProviderCache(telegramService.CacheStats)
+	app.Get("/metrics", adaptor.HTTPHandler(metrics.Handler()))
+
+	// Runtime log level, when an admin token is configured
+	admin.Register(app, logger, cfg.Admin.Token, logLevel)
+
+	var updateQueue *queue.Pool
+	var polling <-chan struct{}
+
+	// Cancelled when in-flight updates outlive the shutdown timeout
+	pollingCtx, cancelPolling := context.WithCancel(context.Background())
+	defer cancelPolling()
+
+	switch cfg.RunMode {
+	case config.RunModeWebhook:
+		updateQueue = queue.NewPool(logger, queue.Config{
+			Workers:      cfg.Queue.Workers,
+			Size:         cfg.Queue.Size,
+			Overflow:     queue.OverflowPolicy(cfg.Queue.Overflow),
+			BlockTimeout: cfg.Queue.BlockTimeout.Std(),
+		}, webhookHandler.Process)
+		metrics.RegisterQueueDepth(updateQueue.Len)
+		webhookHandler.UseQueue(updateQueue)
+
+		// Webhook endpoint
+		app.Post(webhook.Path, webhookHandler.HandleWebhook)
+		logger.Info("Starting bot in webhook mode")
+		// Register once the server is listening, so Telegram does not
+		// deliver to a port that is not open yet
+		app.Hooks().OnListen(func(fiber.ListenData) error {
+			go startWebhookMode(bot, cfg.Webhook, logger)
+			return nil
+		})
+	case config.RunModePolling:
+		// Polling mode for local development
+		logger.Info("Starting bot in polling mode")
+		polling = startPollingMode(pollingCtx, bot, telegramService, logger)
+	case config.RunModeNone:
+		logger.Info("Update handling disabled, serving HTTP endpoints only")
+	}
 
-	// Polling mode for local development
-	logger.Info("Starting bot in polling mode for local development")
-	startPollingMode(bot, telegramService, logger)
+	go func() {
+		if err := app.Listen(cfg.ListenAddr); err != nil {
+			logger.Fatal("HTTP server failed", zap.String("addr", cfg.ListenAddr), zap.Error(err))
+		}
+	}()
 
 	// Wait for interrupt signal to gracefully shutdown the server
 	quit := make(chan os.Signal, 1)
@@ -76,14 +156,54 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	if polling != nil {
+		bot.StopLongPolling()
+		select {
+		case <-polling:
+		case <-ctx.Done():
+			logger.Warn("Cancelling updates still in flight")
+			cancelPolling()
+		}
+	}
+
 	if err := app.ShutdownWithContext(ctx); err != nil {
 		logger.Fatal("Server forced to shutdown", zap.Error(err))
 	}
 
+	if updateQueue != nil {
+		if err := updateQueue.Shutdown(ctx); err != nil {
+			logger.Warn("Update queue did not drain before shutdown", zap.Int("pending", updateQueue.Len()), zap.Error(err))
+		}
+	}
+
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Warn("failed to flush traces", zap.Error(err))
+	}
+
 	logger.Info("Server exited")
 }
 
-func startPollingMode(bot *telego.Bot, service *service.TelegramChannelImpl, logger *zap.Logger) {
+func startWebhookMode(bot *telego.Bot, cfg config.Webhook, logger *zap.Logger) {
+	if cfg.Secret == "" {
+		logger.Warn("WEBHOOK_SECRET is not set, webhook requests will not be verified")
+	}
+
+	err := webhook.Register(bot, webhook.Config{
+		URL:            cfg.URL,
+		SecretToken:    cfg.Secret,
+		MaxConnections: cfg.MaxConnections,
+		AllowedUpdates: []string{"message"},
+	})
+	if err != nil {
+		logger.Fatal("Failed to register webhook", zap.Error(err))
+	}
+
+	logger.Info("Webhook registered successfully")
+}
+
+// startPollingMode processes updates with ctx until polling stops, closing
+// the returned channel once the last update is done.
+func startPollingMode(ctx context.Context, bot *telego.Bot, svc *service.TelegramChannelImpl, logger *zap.Logger) <-chan struct{} {
 	// Delete webhook to ensure polling works
 	if err := bot.DeleteWebhook(&telego.DeleteWebhookParams{DropPendingUpdates: true}); err != nil {
 		logger.Warn("Failed to delete webhook", zap.Error(err))
@@ -99,31 +219,27 @@ func startPollingMode(bot *telego.Bot, service *service.TelegramChannelImpl, log
 	}
 
 	// Process updates
+	done := make(chan struct{})
 	go func() {
+		defer close(done)
 		for update := range updates {
+			updateType := webhook.UpdateType(update)
+			metrics.UpdatesReceived.WithLabelValues(updateType).Inc()
 			logger.Info("Received update",
 				zap.Int("update_id", update.UpdateID),
-				zap.String("type", getUpdateType(update)))
+				zap.String("type", updateType))
 
 			// Process the update
-			if err := service.ProcessMedia(update); err != nil {
+			// Failed links are logged with the report
+			report, err := svc.ProcessMedia(ctx, update)
+			if report != nil {
+				service.LogReport(logger, report)
+			} else if err != nil {
 				logger.Error("Failed to process update", zap.Error(err))
 			}
 		}
 	}()
 
 	logger.Info("Polling started successfully")
-}
-
-func getUpdateType(update telego.Update) string {
-	if update.Message != nil {
-		return "message"
-	}
-	if update.CallbackQuery != nil {
-		return "callback_query"
-	}
-	if update.InlineQuery != nil {
-		return "inline_query"
-	}
-	return "unknown"
+	return done
 }
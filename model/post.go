@@ -0,0 +1,128 @@
+package model
+
+import (
+	"sort"
+	"time"
+)
+
+type MediaType string
+
+const (
+	MediaPhoto MediaType = "photo"
+	MediaVideo MediaType = "video"
+	MediaAudio MediaType = "audio"
+)
+
+// Post is the normalized shape every integration maps its response into.
+type Post struct {
+	// Source is the integration that produced the post (e.g. "fxtwitter").
+	Source    string
+	URL       string
+	Author    Author
+	Text      string
+	Stats     *Stats
+	Media     []Media
+	Sensitive bool
+}
+
+type Author struct {
+	Name     string
+	Username string
+}
+
+// DisplayName returns the handle when known, falling back to the full name.
+func (a Author) DisplayName() string {
+	if a.Username != "" {
+		return a.Username
+	}
+	return a.Name
+}
+
+type Stats struct {
+	Likes   int
+	Reposts int
+	Replies int
+	Views   int
+}
+
+// Media is a single attachment of a post, in display order.
+type Media struct {
+	Type      MediaType
+	URL       string
+	Width     int
+	Height    int
+	Duration  time.Duration
+	Thumbnail string
+	Variants  []Variant
+	// Title names an audio track.
+	Title string
+	// Data holds media already downloaded, uploaded as FileName instead of
+	// letting Telegram fetch URL.
+	Data     []byte
+	FileName string
+	// FileID is a file already on Telegram servers, sent instead of URL and
+	// Data.
+	FileID string
+}
+
+// Variant is an alternative encoding of a video.
+type Variant struct {
+	URL         string
+	ContentType string
+	// Bitrate in bits per second, zero when unknown.
+	Bitrate int
+}
+
+// EstimatedSize estimates the variant size in bytes using bitrate and duration.
+func (v Variant) EstimatedSize(duration time.Duration) int64 {
+	bytesPerSecond := int64(v.Bitrate) / 8
+	return int64(duration.Seconds() * float64(bytesPerSecond))
+}
+
+// BestVariant selects the largest variant with a known bitrate that fits maxSizeBytes.
+func (m Media) BestVariant(maxSizeBytes int64) (Variant, bool) {
+	var sized []Variant
+	for _, v := range m.Variants {
+		if v.Bitrate > 0 {
+			sized = append(sized, v)
+		}
+	}
+
+	sort.Slice(sized, func(i, j int) bool {
+		return sized[i].EstimatedSize(m.Duration) < sized[j].EstimatedSize(m.Duration)
+	})
+
+	for i := len(sized) - 1; i >= 0; i-- {
+		if sized[i].EstimatedSize(m.Duration) <= maxSizeBytes {
+			return sized[i], true
+		}
+	}
+	return Variant{}, false
+}
+
+// ForTelegram picks the URL and type to send for m under maxSizeBytes. Videos
+// whose variants are all too large degrade to their thumbnail; media already on
+// Telegram servers is always sent.
+func (m Media) ForTelegram(maxSizeBytes int64) (string, MediaType, bool) {
+	if m.FileID != "" {
+		return m.URL, m.Type, true
+	}
+	switch m.Type {
+	case MediaVideo:
+		if len(m.Variants) > 0 {
+			if v, ok := m.BestVariant(maxSizeBytes); ok {
+				return v.URL, MediaVideo, true
+			}
+			if m.Thumbnail != "" {
+				return m.Thumbnail, MediaPhoto, true
+			}
+		}
+		// Without variants use the original URL (might exceed size limit)
+		return m.URL, MediaVideo, m.URL != ""
+	case MediaPhoto:
+		return m.URL, MediaPhoto, m.URL != ""
+	case MediaAudio:
+		return m.URL, MediaAudio, m.URL != "" || len(m.Data) > 0
+	}
+	return "", "", false
+}
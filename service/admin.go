@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"thumb-bot/infra/logs"
+
+	"github.com/mymmrac/telego"
+	"go.uber.org/zap"
+)
+
+const accessUsage = `Usage:
+/access - show the ban and allow lists
+/ban <user_id> - or reply to a message of the user
+/unban <user_id>
+/banchat [chat_id] - defaults to the current chat
+/unbanchat [chat_id]
+/allow [chat_id]
+/disallow [chat_id]
+/allowlist on|off - serve only allowed chats`
+
+// isOwner reports whether message was sent by one of the bot owners listed
+// in TELEGRAM_OWNER_IDS.
+func (t *TelegramChannelImpl) isOwner(message *telego.Message) bool {
+	if message.From == nil {
+		return false
+	}
+	_, ok := t.ownerIDs[message.From.ID]
+	return ok
+}
+
+func isAccessCommand(name string) bool {
+	switch name {
+	case "access", "ban", "unban", "banchat", "unbanchat", "allow", "disallow", "allowlist":
+		return true
+	}
+	return false
+}
+
+// handleAccessCommand runs an owner command. Commands from anyone else are
+// ignored so the bot does not reveal them.
+func (t *TelegramChannelImpl) handleAccessCommand(ctx context.Context, message *telego.Message, name string, args []string) error {
+	if !t.isOwner(message) {
+		return nil
+	}
+
+	if name == "access" {
+		return t.replyText(ctx, message, t.describeAccess()+"\n\n"+accessUsage)
+	}
+
+	var err error
+	switch name {
+	case "ban", "unban":
+		var userID int64
+		userID, err = targetUser(message, args)
+		if err != nil {
+			break
+		}
+		if name == "ban" {
+			err = t.access.BanUser(userID)
+		} else {
+			err = t.access.UnbanUser(userID)
+		}
+	case "banchat", "unbanchat", "allow", "disallow":
+		var chatID int64
+		chatID, err = targetChat(message, args)
+		if err != nil {
+			break
+		}
+		switch name {
+		case "banchat":
+			err = t.access.BanChat(chatID)
+		case "unbanchat":
+			err = t.access.UnbanChat(chatID)
+		case "allow":
+			err = t.access.AllowChat(chatID)
+		case "disallow":
+			err = t.access.DisallowChat(chatID)
+		}
+	case "allowlist":
+		if len(args) == 0 {
+			err = fmt.Errorf("missing value, expected on or off")
+			break
+		}
+		var on bool
+		on, err = parseSwitch(strings.ToLower(args[0]))
+		if err == nil {
+			err = t.access.SetAllowlistMode(on)
+		}
+	}
+	if err != nil {
+		return t.replyText(ctx, message, err.Error()+"\n\n"+accessUsage)
+	}
+
+	// The arguments are user and chat IDs, so only the command is logged
+	logs.FromContext(ctx, t.logger).Info("access lists updated", zap.String("command", name), zap.Int64(logs.UserIDKey, message.From.ID))
+	return t.replyText(ctx, message, t.describeAccess())
+}
+
+// targetUser returns the user given as argument or the author of the
+// message being replied to.
+func targetUser(message *telego.Message, args []string) (int64, error) {
+	if len(args) > 0 {
+		return parseID(args[0])
+	}
+	if reply := message.ReplyToMessage; reply != nil && reply.From != nil {
+		return reply.From.ID, nil
+	}
+	return 0, fmt.Errorf("missing user id")
+}
+
+// targetChat returns the chat given as argument or the current chat.
+func targetChat(message *telego.Message, args []string) (int64, error) {
+	if len(args) > 0 {
+		return parseID(args[0])
+	}
+	return message.Chat.ID, nil
+}
+
+func parseID(raw string) (int64, error) {
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid id %q", raw)
+	}
+	return id, nil
+}
+
+func (t *TelegramChannelImpl) describeAccess() string {
+	state := t.access.Snapshot()
+
+	join := func(ids []int64) string {
+		if len(ids) == 0 {
+			return "none"
+		}
+		parts := make([]string, len(ids))
+		for i, id := range ids {
+			parts[i] = strconv.FormatInt(id, 10)
+		}
+		return strings.Join(parts, ", ")
+	}
+	mode := "off"
+	if state.AllowlistMode {
+		mode = "on"
+	}
+
+	return fmt.Sprintf("Access:\nbanned users: %s\nbanned chats: %s\nallowed chats: %s\nallowlist: %s",
+		join(state.BannedUsers), join(state.BannedChats), join(state.AllowedChats), mode)
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"thumb-bot/infra/breaker"
+	"thumb-bot/integration"
+	"thumb-bot/model"
+
+	"go.uber.org/zap"
+)
+
+// breakerProvider stops calling a provider whose upstream keeps failing,
+// failing fast until its cooldown passes.
+type breakerProvider struct {
+	Provider
+	logger  *zap.Logger
+	breaker *breaker.Breaker
+}
+
+func newBreakerProvider(logger *zap.Logger, p Provider, b *breaker.Breaker) *breakerProvider {
+	return &breakerProvider{Provider: p, logger: logger, breaker: b}
+}
+
+func (p *breakerProvider) Fetch(ctx context.Context, u *url.URL) (*model.Post, error) {
+	if err := p.breaker.Allow(); err != nil {
+		return nil, fmt.Errorf("%s: %w", p.Name(), err)
+	}
+
+	post, err := p.Provider.Fetch(ctx, u)
+
+	wasOpen := p.breaker.Open()
+	p.breaker.Done(isUpstreamFailure(err))
+	if open := p.breaker.Open(); open && !wasOpen {
+		p.logger.Warn("provider keeps failing, pausing requests", zap.String("provider", p.Name()), zap.Error(err))
+	} else if !open && wasOpen {
+		p.logger.Info("provider recovered", zap.String("provider", p.Name()))
+	}
+	return post, err
+}
+
+// isUpstreamFailure tells failures of the platform from results it served,
+// such as deleted posts or media over our size limits, and from updates
+// cancelled on our side.
+func isUpstreamFailure(err error) bool {
+	var ne *noticeError
+	switch {
+	case err == nil, isFinal(err), errors.As(err, &ne), errors.Is(err, context.Canceled),
+		errors.Is(err, integration.ErrTooLarge):
+		return false
+	}
+	return true
+}
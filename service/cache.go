@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"thumb-bot/infra/cache"
+	"thumb-bot/integration"
+	"thumb-bot/model"
+)
+
+// cachingProvider answers repeated requests for a post from a cache keyed by
+// its canonical URL, so concurrent and repeated links make one upstream call.
+type cachingProvider struct {
+	Provider
+	cache *cache.Cache[*model.Post]
+}
+
+func newCachingProvider(p Provider, cfg cache.Config[*model.Post]) *cachingProvider {
+	cfg.Negative = isFinal
+	cfg.Keep = keepPost
+	return &cachingProvider{Provider: p, cache: cache.New(cfg)}
+}
+
+func (p *cachingProvider) Fetch(ctx context.Context, u *url.URL) (*model.Post, error) {
+	key := p.Canonical(u)
+	if key == "" {
+		return p.Provider.Fetch(ctx, u)
+	}
+	return p.cache.Get(ctx, key, func(ctx context.Context) (*model.Post, error) {
+		return p.Provider.Fetch(ctx, u)
+	})
+}
+
+// isFinal reports whether a fetch error will not change on retry and may be
+// cached for the negative TTL.
+func isFinal(err error) bool {
+	return errors.Is(err, integration.ErrNotFound) || errors.Is(err, integration.ErrPrivate)
+}
+
+// keepPost leaves out posts carrying downloaded media, such as Vocaroo
+// recordings, which are too large to keep; the file_id cache covers them.
+func keepPost(post *model.Post) bool {
+	if post == nil {
+		return true
+	}
+	for _, media := range post.Media {
+		if len(media.Data) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// CacheStats returns the provider cache counters by provider name.
+func (t *TelegramChannelImpl) CacheStats() map[string]cache.Stats {
+	stats := make(map[string]cache.Stats)
+	for _, p := range t.registry.Providers() {
+		if cp, ok := p.(*cachingProvider); ok {
+			stats[p.Name()] = cp.cache.Stats()
+		}
+	}
+	return stats
+}
@@ -0,0 +1,245 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"thumb-bot/infra/logs"
+	"thumb-bot/settings"
+
+	"github.com/mymmrac/telego"
+	"go.uber.org/zap"
+)
+
+const settingsUsage = `Usage:
+/settings - show the current settings
+/settings caption full|compact|link
+/settings reply on|off
+/settings delete on|off
+/settings nsfw show|spoiler|hide
+/settings errors on|off
+/settings provider <name> on|off
+/settings media photo|video|audio on|off`
+
+func isCommand(message *telego.Message) bool {
+	return strings.HasPrefix(message.Text, "/")
+}
+
+// parseCommand splits "/cmd@bot arg1 arg2" into its lowercase name, the bot
+// it is addressed to and its arguments.
+func parseCommand(text string) (name, target string, args []string) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return "", "", nil
+	}
+	name = strings.ToLower(strings.TrimPrefix(fields[0], "/"))
+	if at := strings.Index(name, "@"); at >= 0 {
+		name, target = name[:at], name[at+1:]
+	}
+	return name, target, fields[1:]
+}
+
+func (t *TelegramChannelImpl) handleCommand(ctx context.Context, message *telego.Message) error {
+	name, target, args := parseCommand(message.Text)
+	if target != "" {
+		// Commands addressed to another bot in the same group
+		if username := t.botUsername(); username != "" && !strings.EqualFold(target, username) {
+			return nil
+		}
+	}
+
+	switch {
+	case name == "settings":
+		return t.handleSettingsCommand(ctx, message, args)
+	case isAccessCommand(name):
+		return t.handleAccessCommand(ctx, message, name, args)
+	}
+	return nil
+}
+
+func (t *TelegramChannelImpl) handleSettingsCommand(ctx context.Context, message *telego.Message, args []string) error {
+	logger := logs.FromContext(ctx, t.logger)
+	if !t.isChatAdmin(ctx, message) {
+		return t.replyText(ctx, message, "Only chat administrators can change the settings.")
+	}
+
+	chat, err := t.settings.Get(message.Chat.ID)
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		return t.replyText(ctx, message, describeSettings(chat, t.registry)+"\n\n"+settingsUsage)
+	}
+
+	if err := applySetting(&chat, t.registry, args); err != nil {
+		return t.replyText(ctx, message, err.Error()+"\n\n"+settingsUsage)
+	}
+
+	if err := t.settings.Put(message.Chat.ID, chat); err != nil {
+		logger.Error("failed to save chat settings", zap.Error(err))
+		return t.replyText(ctx, message, "Failed to save the settings, please try again.")
+	}
+
+	logger.Info("chat settings updated", zap.String("setting", strings.ToLower(args[0])))
+	return t.replyText(ctx, message, describeSettings(chat, t.registry))
+}
+
+func applySetting(chat *settings.Chat, registry *Registry, args []string) error {
+	key := strings.ToLower(args[0])
+	values := args[1:]
+	if len(values) == 0 {
+		return fmt.Errorf("missing value for %q", key)
+	}
+	value := strings.ToLower(values[0])
+
+	switch key {
+	case "caption":
+		style, err := settings.ParseCaptionStyle(value)
+		if err != nil {
+			return err
+		}
+		chat.CaptionStyle = style
+	case "reply":
+		on, err := parseSwitch(value)
+		if err != nil {
+			return err
+		}
+		chat.Standalone = !on
+	case "delete":
+		on, err := parseSwitch(value)
+		if err != nil {
+			return err
+		}
+		chat.DeleteOriginal = on
+	case "nsfw":
+		mode, err := settings.ParseNSFWMode(value)
+		if err != nil {
+			return err
+		}
+		chat.NSFW = mode
+	case "errors":
+		on, err := parseSwitch(value)
+		if err != nil {
+			return err
+		}
+		chat.ErrorReplies = on
+	case "provider":
+		if len(values) < 2 {
+			return fmt.Errorf("usage: /settings provider <name> on|off")
+		}
+		if !registry.Has(value) {
+			return fmt.Errorf("unknown provider %q", value)
+		}
+		on, err := parseSwitch(strings.ToLower(values[1]))
+		if err != nil {
+			return err
+		}
+		chat.SetProvider(value, on)
+	case "media":
+		if len(values) < 2 {
+			return fmt.Errorf("usage: /settings media photo|video|audio on|off")
+		}
+		kind, err := settings.ParseMediaKind(value)
+		if err != nil {
+			return err
+		}
+		on, err := parseSwitch(strings.ToLower(values[1]))
+		if err != nil {
+			return err
+		}
+		chat.SetMedia(kind, on)
+	default:
+		return fmt.Errorf("unknown setting %q", key)
+	}
+	return nil
+}
+
+func parseSwitch(value string) (bool, error) {
+	switch value {
+	case "on", "true", "yes":
+		return true, nil
+	case "off", "false", "no":
+		return false, nil
+	}
+	return false, fmt.Errorf("expected on or off, got %q", value)
+}
+
+func describeSettings(chat settings.Chat, registry *Registry) string {
+	onOff := func(on bool) string {
+		if on {
+			return "on"
+		}
+		return "off"
+	}
+
+	var providers []string
+	for _, p := range registry.Providers() {
+		providers = append(providers, fmt.Sprintf("%s: %s", p.Name(), onOff(chat.ProviderEnabled(p.Name()))))
+	}
+
+	var media []string
+	for _, kind := range []string{settings.MediaPhoto, settings.MediaVideo, settings.MediaAudio} {
+		media = append(media, fmt.Sprintf("%s: %s", kind, onOff(chat.MediaEnabled(kind))))
+	}
+
+	return fmt.Sprintf("Settings:\ncaption: %s\nreply: %s\ndelete: %s\nnsfw: %s\nerrors: %s\nproviders: %s\nmedia: %s",
+		chat.CaptionStyle, onOff(!chat.Standalone), onOff(chat.DeleteOriginal), chat.NSFW, onOff(chat.ErrorReplies),
+		strings.Join(providers, ", "), strings.Join(media, ", "))
+}
+
+// isChatAdmin reports whether the sender of message administers its chat.
+// Everyone administers their private chat with the bot, and anonymous
+// admins post on behalf of the chat itself.
+func (t *TelegramChannelImpl) isChatAdmin(ctx context.Context, message *telego.Message) bool {
+	if message.Chat.Type == telego.ChatTypePrivate {
+		return true
+	}
+	if message.SenderChat != nil && message.SenderChat.ID == message.Chat.ID {
+		return true
+	}
+	if message.From == nil {
+		return false
+	}
+
+	member, err := traceTelegram(ctx, "getChatMember", func() (telego.ChatMember, error) {
+		return t.bot.GetChatMember(&telego.GetChatMemberParams{
+			ChatID: telego.ChatID{ID: message.Chat.ID},
+			UserID: message.From.ID,
+		})
+	})
+	if err != nil {
+		logs.FromContext(ctx, t.logger).Warn("failed to get chat member", zap.Error(err))
+		return false
+	}
+
+	switch member.MemberStatus() {
+	case telego.MemberStatusCreator, telego.MemberStatusAdministrator:
+		return true
+	}
+	return false
+}
+
+// botUsername returns the bot's username, fetching it once.
+func (t *TelegramChannelImpl) botUsername() string {
+	t.usernameOnce.Do(func() {
+		me, err := t.bot.GetMe()
+		if err != nil {
+			t.logger.Warn("failed to get bot username", zap.Error(err))
+			return
+		}
+		t.username = me.Username
+	})
+	return t.username
+}
+
+func (t *TelegramChannelImpl) replyText(ctx context.Context, message *telego.Message, text string) error {
+	_, err := traceTelegram(ctx, "sendMessage", func() (*telego.Message, error) {
+		return t.bot.SendMessage(&telego.SendMessageParams{
+			ChatID:           telego.ChatID{ID: message.Chat.ID},
+			Text:             text,
+			ReplyToMessageID: message.MessageID,
+		})
+	})
+	return err
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"thumb-bot/infra/breaker"
+	"thumb-bot/infra/download"
+	"thumb-bot/infra/logs"
+	"thumb-bot/integration"
+	"thumb-bot/settings"
+
+	"github.com/mymmrac/telego"
+	"go.uber.org/zap"
+)
+
+// Failure categories, used as metric labels.
+const (
+	failureNotFound      = "not_found"
+	failurePrivate       = "private"
+	failureAgeRestricted = "age_restricted"
+	failureRateLimited   = "rate_limited"
+	failureTooLarge      = "too_large"
+	failureUnavailable   = "unavailable"
+	failureOther         = "error"
+)
+
+// failureCategory sorts err into one of the failure categories.
+func failureCategory(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, integration.ErrNotFound):
+		return failureNotFound
+	case errors.Is(err, integration.ErrPrivate):
+		return failurePrivate
+	case errors.Is(err, integration.ErrAgeRestricted):
+		return failureAgeRestricted
+	case errors.Is(err, integration.ErrRateLimited):
+		return failureRateLimited
+	case errors.Is(err, integration.ErrTooLarge), errors.Is(err, download.ErrTooLarge):
+		return failureTooLarge
+	case errors.Is(err, integration.ErrUnavailable), errors.Is(err, breaker.ErrOpen),
+		errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr):
+		return failureUnavailable
+	}
+	return failureOther
+}
+
+// failureReason returns a short explanation of why the post behind a link of
+// provider could not be sent.
+func failureReason(provider string, err error) string {
+	switch failureCategory(err) {
+	case failureNotFound:
+		return "the post was not found, it may have been deleted"
+	case failurePrivate:
+		return "the post is private"
+	case failureAgeRestricted:
+		return "the post is age-restricted"
+	case failureRateLimited:
+		return fmt.Sprintf("%s is limiting our requests, please try again later", provider)
+	case failureTooLarge:
+		return "the media is too large to send"
+	case failureUnavailable:
+		return fmt.Sprintf("%s is not responding, please try again later", provider)
+	}
+	return "something went wrong"
+}
+
+// replyFailure tells the sender why the link was not posted, when the chat
+// asked for it. Replies are rate limited per chat so a broken provider does
+// not flood a group.
+func (t *TelegramChannelImpl) replyFailure(ctx context.Context, message *telego.Message, chat settings.Chat, provider string, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	t.replyError(ctx, message, chat, fmt.Sprintf("Couldn't post that link: %s.", failureReason(provider, err)))
+}
+
+// replyError sends text to the sender of message under the same rules as
+// replyFailure, for errors explained by the provider itself.
+func (t *TelegramChannelImpl) replyError(ctx context.Context, message *telego.Message, chat settings.Chat, text string) {
+	if !chat.ErrorReplies {
+		return
+	}
+	logger := logs.FromContext(ctx, t.logger)
+	if !t.errorReplyLimiter.Allow(strconv.FormatInt(message.Chat.ID, 10)) {
+		logger.Debug("error reply rate limited")
+		return
+	}
+	if err := t.replyText(ctx, message, text); err != nil {
+		logger.Warn("failed to send error reply", zap.Error(err))
+	}
+}
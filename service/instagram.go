@@ -1,13 +1,14 @@
 package service
 
 import (
-	"fmt"
+	"context"
 	"net/url"
 	"strings"
+	"thumb-bot/infra/logs"
 	"thumb-bot/integration/instagram"
+	"thumb-bot/model"
 	"thumb-bot/utils"
 
-	"github.com/mymmrac/telego"
 	"go.uber.org/zap"
 )
 
@@ -16,78 +17,52 @@ var instagramHosts = []string{
 	"www.instagram.com",
 }
 
-func (t *TelegramChannelImpl) processInstagramMedia(update telego.Update) error {
-	if update.Message == nil || update.Message.Text == "" {
-		return nil
-	}
-
-	payload := update.Message.Text
-	links := utils.ExtractLinks(payload)
-	if len(links) == 0 {
-		return nil
-	}
+type instagramProvider struct {
+	logger *zap.Logger
+	client *instagram.Client
+}
 
-	instaUrl, err := url.Parse(links[0])
-	if err != nil {
-		t.logger.Error("failed to parse instaUrl", zap.Error(err))
-		return err
-	}
+func newInstagramProvider(logger *zap.Logger, client *instagram.Client) *instagramProvider {
+	return &instagramProvider{logger: logger, client: client}
+}
 
-	for _, host := range instagramHosts {
-		if instaUrl.Host == host {
+func (p *instagramProvider) Name() string {
+	return "instagram"
+}
 
-			if strings.Contains(instaUrl.String(), "/stories") {
-				return nil
-			}
+func (p *instagramProvider) Hosts() []string {
+	return instagramHosts
+}
 
-			t.logger.Info("fetching instagram post", zap.String("instaUrl", instaUrl.String()))
-			response, err := instagram.GetURL(instaUrl.Path)
-			if err != nil {
-				t.logger.Error("failed to instagram post", zap.Error(err))
-				return err
-			}
+func (p *instagramProvider) Priority() int {
+	return 20
+}
 
-			if len(response.MediaDetails) > 0 {
-				formatedUrl := utils.RemoveQueryParams(instaUrl.String())
-				var mediaGroup []telego.InputMedia
+func (p *instagramProvider) Capabilities() Capability {
+	return CapabilityPhoto | CapabilityVideo | CapabilityMediaGroup
+}
 
-				caption := fmt.Sprintf("%s\n\n%s", formatedUrl, response.PostInfo.OwnerUsername)
-				if len(response.PostInfo.Caption) > 0 {
-					caption = fmt.Sprintf("%s\n\n%s: %s", formatedUrl, response.PostInfo.OwnerUsername, response.PostInfo.Caption)
-				}
+func (p *instagramProvider) Canonical(u *url.URL) string {
+	shortcode, err := instagram.Shortcode(u.Path)
+	if err != nil {
+		return ""
+	}
+	return "https://www.instagram.com/p/" + shortcode + "/"
+}
 
-				media := response.MediaDetails[0]
-				switch media.Type {
-				case "video":
-					mediaGroup = append(mediaGroup, &telego.InputMediaVideo{
-						Media:     telego.InputFile{URL: media.URL},
-						Caption:   caption,
-						ParseMode: "HTML",
-						Type:      "video",
-					})
-				case "image":
-					mediaGroup = append(mediaGroup, &telego.InputMediaPhoto{
-						Media:     telego.InputFile{URL: media.URL},
-						Caption:   caption,
-						ParseMode: "HTML",
-						Type:      "photo",
-					})
-				}
+func (p *instagramProvider) Fetch(ctx context.Context, instaUrl *url.URL) (*model.Post, error) {
+	logger := logs.FromContext(ctx, p.logger)
+	if strings.Contains(instaUrl.String(), "/stories") {
+		return nil, nil
+	}
 
-				if len(mediaGroup) > 0 {
-					// Send media group using the bot instance
-					_, err = t.bot.SendMediaGroup(&telego.SendMediaGroupParams{
-						ChatID:           telego.ChatID{ID: update.Message.Chat.ID},
-						Media:            mediaGroup,
-						ReplyToMessageID: update.Message.MessageID,
-					})
-					if err != nil {
-						t.logger.Error("failed to send media group", zap.Error(err))
-						return err
-					}
-				}
-			}
-		}
+	logger.Info("fetching instagram post", zap.String("instaUrl", instaUrl.String()))
+	response, err := p.client.GetURL(ctx, instaUrl.Path)
+	if err != nil {
+		logger.Error("failed to instagram post", zap.Error(err))
+		return nil, err
 	}
-	return nil
+
+	post := response.ToPost(utils.RemoveQueryParams(instaUrl.String()))
+	return &post, nil
 }
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"thumb-bot/infra/metrics"
+	"thumb-bot/infra/tracing"
+	"thumb-bot/model"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// instrumentedProvider records the duration and outcome of every fetch of
+// the embedded provider, and traces it.
+type instrumentedProvider struct {
+	Provider
+}
+
+func (p instrumentedProvider) Fetch(ctx context.Context, u *url.URL) (*model.Post, error) {
+	ctx, span := tracing.Start(ctx, "fetch "+p.Name(), attribute.String("provider", p.Name()))
+	start := time.Now()
+	post, err := p.Provider.Fetch(ctx, u)
+	outcome := fetchOutcome(err)
+	metrics.ProviderFetchDuration.WithLabelValues(p.Name(), outcome).Observe(metrics.Since(start))
+	span.SetAttributes(attribute.String("outcome", outcome))
+	tracing.End(span, err)
+	return post, err
+}
+
+// fetchOutcome labels a fetch with "ok", "notice", "canceled" or the
+// failure category of err.
+func fetchOutcome(err error) string {
+	var ne *noticeError
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.As(err, &ne):
+		return "notice"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	}
+	return failureCategory(err)
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"thumb-bot/access"
+	"thumb-bot/filecache"
+	"thumb-bot/infra/dedup"
+	"thumb-bot/infra/httpclient"
+	"thumb-bot/settings"
+)
+
+// Option customizes the service created by NewTelegramService.
+type Option func(*TelegramChannelImpl)
+
+// WithDedupStore replaces the in-memory store used to skip updates that were
+// already processed, e.g. with a persistent one shared across restarts.
+func WithDedupStore(store dedup.Store) Option {
+	return func(t *TelegramChannelImpl) {
+		t.dedup = store
+	}
+}
+
+// WithSettingsStore sets where per-chat settings are kept. Without it
+// settings only live in memory.
+func WithSettingsStore(store settings.Store) Option {
+	return func(t *TelegramChannelImpl) {
+		t.settings = store
+	}
+}
+
+// WithAccessStore sets where the ban and allow lists are persisted. Without
+// it they only live in memory.
+func WithAccessStore(store access.Store) Option {
+	return func(t *TelegramChannelImpl) {
+		t.accessStore = store
+	}
+}
+
+// WithFileCache sets where the file_ids of sent posts are kept. Without it
+// they only live in memory.
+func WithFileCache(store filecache.Store) Option {
+	return func(t *TelegramChannelImpl) {
+		t.fileCache = store
+	}
+}
+
+// WithHTTPClients sets the factory of the clients the integrations call
+// their platforms with, instead of one made from the configuration.
+func WithHTTPClients(factory *httpclient.Factory) Option {
+	return func(t *TelegramChannelImpl) {
+		t.httpClients = factory
+	}
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+	"thumb-bot/config"
+	"thumb-bot/infra/httpclient"
+	"thumb-bot/integration/fxtwitter"
+	"thumb-bot/integration/instagram"
+	"thumb-bot/integration/vocaroo"
+	"thumb-bot/integration/vxtwitter"
+	"thumb-bot/integration/youtube"
+	"thumb-bot/model"
+	"thumb-bot/settings"
+
+	"go.uber.org/zap"
+)
+
+// Capability describes a kind of content a provider is able to produce.
+type Capability uint8
+
+const (
+	CapabilityText Capability = 1 << iota
+	CapabilityPhoto
+	CapabilityVideo
+	CapabilityAudio
+	CapabilityMediaGroup
+)
+
+// Has reports whether every capability in other is also set in c.
+func (c Capability) Has(other Capability) bool {
+	return c&other == other
+}
+
+// mediaCapabilities maps the media kinds chats can turn off to their
+// capability.
+var mediaCapabilities = map[string]Capability{
+	settings.MediaPhoto: CapabilityPhoto,
+	settings.MediaVideo: CapabilityVideo,
+	settings.MediaAudio: CapabilityAudio,
+}
+
+// accepted returns the capabilities chat accepts posts with.
+func accepted(chat settings.Chat) Capability {
+	c := CapabilityText | CapabilityPhoto | CapabilityVideo | CapabilityAudio | CapabilityMediaGroup
+	for kind, capability := range mediaCapabilities {
+		if !chat.MediaEnabled(kind) {
+			c &^= capability
+		}
+	}
+	return c
+}
+
+// Provider expands links from a single platform. The registry hands it the
+// links to its Hosts and Fetch resolves them into a normalized post, which
+// the service renders into the chat.
+type Provider interface {
+	Name() string
+	// Hosts lists the lowercase hostnames of the links the provider handles.
+	Hosts() []string
+	// Priority decides between providers claiming the same host.
+	Priority() int
+	// Capabilities lists the kinds of content the posts of the provider may
+	// hold. Chats accepting none of them are not sent its links.
+	Capabilities() Capability
+	// Canonical returns a URL identifying the post behind u across its link
+	// variants (hosts, query strings, mobile links), or "" when it cannot be
+	// told before fetching.
+	Canonical(u *url.URL) string
+	// Fetch returns a nil post when the URL is recognised but there is
+	// nothing to send (e.g. Instagram stories).
+	Fetch(ctx context.Context, u *url.URL) (*model.Post, error)
+}
+
+// Registry holds the known providers ordered by descending priority and
+// dispatches links to them by host.
+type Registry struct {
+	providers []Provider
+	byHost    map[string]Provider
+}
+
+func NewRegistry(providers ...Provider) *Registry {
+	r := &Registry{byHost: make(map[string]Provider)}
+	for _, p := range providers {
+		r.Register(p)
+	}
+	return r
+}
+
+// Register adds a provider, keeping the list ordered by priority.
+func (r *Registry) Register(p Provider) {
+	r.providers = append(r.providers, p)
+	sort.SliceStable(r.providers, func(i, j int) bool {
+		return r.providers[i].Priority() > r.providers[j].Priority()
+	})
+	for _, host := range p.Hosts() {
+		if current, ok := r.byHost[host]; !ok || p.Priority() > current.Priority() {
+			r.byHost[host] = p
+		}
+	}
+}
+
+// Lookup returns the highest priority provider handling the host of u.
+func (r *Registry) Lookup(u *url.URL) (Provider, bool) {
+	p, ok := r.byHost[strings.ToLower(u.Hostname())]
+	return p, ok
+}
+
+// Has reports whether a provider called name is registered.
+func (r *Registry) Has(name string) bool {
+	for _, p := range r.providers {
+		if p.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Providers returns the registered providers in dispatch order.
+func (r *Registry) Providers() []Provider {
+	return append([]Provider(nil), r.providers...)
+}
+
+// defaultProviders lists every platform the bot supports out of the box,
+// each with clients made by clients.
+func defaultProviders(logger *zap.Logger, clients *httpclient.Factory, cfg config.Config) []Provider {
+	return []Provider{
+		newTwitterProvider(logger,
+			fxtwitter.NewClient(clients.Client("fxtwitter")),
+			vxtwitter.NewClient(clients.Client("vxtwitter")),
+			clients.Client("t.co", httpclient.WithoutRedirects()),
+		),
+		newInstagramProvider(logger, instagram.NewClient(
+			clients.Client("instagram", httpclient.WithCookies()),
+			instagram.Config{
+				Retries:  cfg.Instagram.Retries,
+				Delay:    cfg.Instagram.Delay.Std(),
+				MaxDelay: cfg.Instagram.MaxDelay.Std(),
+			},
+		)),
+		newYouTubeProvider(logger, youtube.NewClient(clients.Client("youtube"))),
+		newVocarooProvider(logger, vocaroo.NewClient(clients.Client("vocaroo",
+			httpclient.WithMaxBodyBytes(vocaroo.MaxSize+1),
+			httpclient.WithTimeout(cfg.Limits.UploadTimeout.Std()),
+		))),
+	}
+}
+
+// noticeError is a fetch error explained to the sender of the link, when the
+// chat has error replies on, instead of failing the update.
+type noticeError struct {
+	text string
+	err  error
+}
+
+func notice(text string, err error) error {
+	return &noticeError{text: text, err: err}
+}
+
+func (e *noticeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *noticeError) Unwrap() error {
+	return e.err
+}
+
+func matchHost(hosts []string, u *url.URL) bool {
+	host := strings.ToLower(u.Hostname())
+	for _, h := range hosts {
+		if host == h {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,341 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"thumb-bot/infra/logs"
+	"thumb-bot/infra/tracing"
+	"thumb-bot/model"
+	"thumb-bot/settings"
+
+	"github.com/mymmrac/telego"
+	"github.com/mymmrac/telego/telegoapi"
+	tu "github.com/mymmrac/telego/telegoutil"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+)
+
+// maxMediaGroupSize is the number of items Telegram accepts per album.
+const maxMediaGroupSize = 10
+
+// caption formats the text attached to the first media item of a post, or
+// the message body when the post has no media.
+func caption(post model.Post, style settings.CaptionStyle, withStats bool) string {
+	text := post.URL
+	if style == settings.CaptionLink {
+		return text
+	}
+
+	author := post.Author.DisplayName()
+	if style == settings.CaptionCompact {
+		if author != "" {
+			text = fmt.Sprintf("%s\n\n%s", text, author)
+		}
+		return text
+	}
+
+	switch {
+	case author != "" && post.Text != "":
+		text = fmt.Sprintf("%s\n\n%s: %s", text, author, post.Text)
+	case author != "":
+		text = fmt.Sprintf("%s\n\n%s", text, author)
+	case post.Text != "":
+		text = fmt.Sprintf("%s\n\n%s", text, post.Text)
+	}
+	if withStats && post.Stats != nil {
+		text = fmt.Sprintf("%s\n\n💟 %d 🔁 %d", text, post.Stats.Likes, post.Stats.Reposts)
+	}
+	return text
+}
+
+// renderPost sends post to the chat of message, following the chat settings:
+// a single photo, video or audio, an album for several attachments, or a text
+// message when there is no media. Media Telegram fails to fetch by URL is
+// downloaded and uploaded by the bot instead.
+//
+// It returns the post as sent, its media replaced by the Telegram file_ids,
+// or nil when nothing was sent.
+func (t *TelegramChannelImpl) renderPost(ctx context.Context, message *telego.Message, post model.Post, chat settings.Chat) (*model.Post, error) {
+	if post.Sensitive && chat.NSFW == settings.NSFWHide {
+		return nil, nil
+	}
+
+	sent, err := t.sendPost(ctx, message, post, chat, t.maxMediaBytes)
+	if err == nil || !isFetchError(err) {
+		return sent, err
+	}
+
+	logger := logs.FromContext(ctx, t.logger)
+	logger.Warn("Telegram failed to fetch media, uploading it instead", zap.String("url", post.URL), zap.Error(err))
+	uploaded, downloadErr := t.downloadMedia(ctx, post)
+	if downloadErr != nil {
+		logger.Warn("failed to download media", zap.String("url", post.URL), zap.Error(downloadErr))
+		return nil, errors.Join(err, downloadErr)
+	}
+	return t.sendPost(ctx, message, uploaded, chat, t.maxUploadBytes)
+}
+
+// sendPost sends post with the media variants that fit maxBytes.
+func (t *TelegramChannelImpl) sendPost(ctx context.Context, message *telego.Message, post model.Post, chat settings.Chat, maxBytes int64) (*model.Post, error) {
+	spoiler := post.Sensitive && chat.NSFW == settings.NSFWSpoiler
+
+	chatID := telego.ChatID{ID: message.Chat.ID}
+	replyTo := replyToMessageID(message, chat)
+
+	var mediaGroup []telego.InputMedia
+	var sentMedia []model.Media
+	for _, media := range post.Media {
+		mediaURL, mediaType, ok := media.ForTelegram(maxBytes)
+		if !ok {
+			continue
+		}
+
+		text := ""
+		if len(mediaGroup) == 0 {
+			text = caption(post, chat.CaptionStyle, true)
+		}
+
+		switch mediaType {
+		case model.MediaVideo:
+			mediaGroup = append(mediaGroup, &telego.InputMediaVideo{
+				Media:      inputFile(media, mediaURL),
+				Caption:    text,
+				ParseMode:  "HTML",
+				Type:       "video",
+				HasSpoiler: spoiler,
+			})
+		case model.MediaPhoto:
+			mediaGroup = append(mediaGroup, &telego.InputMediaPhoto{
+				Media:      inputFile(media, mediaURL),
+				Caption:    text,
+				ParseMode:  "HTML",
+				Type:       "photo",
+				HasSpoiler: spoiler,
+			})
+		case model.MediaAudio:
+			mediaGroup = append(mediaGroup, &telego.InputMediaAudio{
+				Media:     inputFile(media, mediaURL),
+				Caption:   text,
+				ParseMode: "HTML",
+				Type:      "audio",
+				Duration:  int(media.Duration.Seconds()),
+				Title:     media.Title,
+			})
+		default:
+			continue
+		}
+		sentMedia = append(sentMedia, model.Media{
+			Type:     mediaType,
+			URL:      mediaURL,
+			Width:    media.Width,
+			Height:   media.Height,
+			Duration: media.Duration,
+			Title:    media.Title,
+		})
+		if len(mediaGroup) == maxMediaGroupSize {
+			break
+		}
+	}
+
+	sent := post
+	sent.Media = sentMedia
+
+	var messages []telego.Message
+	switch len(mediaGroup) {
+	case 0:
+		if post.Text == "" {
+			return nil, nil
+		}
+		_, err := traceTelegram(ctx, "sendMessage", func() (*telego.Message, error) {
+			return t.bot.SendMessage(&telego.SendMessageParams{
+				ChatID:           chatID,
+				Text:             caption(post, chat.CaptionStyle, false),
+				ParseMode:        "HTML",
+				ReplyToMessageID: replyTo,
+			})
+		})
+		if err != nil {
+			return nil, err
+		}
+	case 1:
+		msg, err := sendSingle(ctx, t.bot, chatID, replyTo, mediaGroup[0])
+		if err != nil {
+			return nil, err
+		}
+		messages = []telego.Message{*msg}
+	default:
+		var err error
+		messages, err = traceTelegram(ctx, "sendMediaGroup", func() ([]telego.Message, error) {
+			return t.bot.SendMediaGroup(&telego.SendMediaGroupParams{
+				ChatID:           chatID,
+				Media:            mediaGroup,
+				ReplyToMessageID: replyTo,
+			})
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range sent.Media {
+		if i < len(messages) {
+			sent.Media[i].FileID = sentFileID(messages[i])
+		}
+	}
+	return &sent, nil
+}
+
+// sentFileID returns the file_id of the media in a sent message, picking the
+// largest size of a photo.
+func sentFileID(msg telego.Message) string {
+	switch {
+	case msg.Video != nil:
+		return msg.Video.FileID
+	case msg.Audio != nil:
+		return msg.Audio.FileID
+	case msg.Animation != nil:
+		return msg.Animation.FileID
+	case msg.Document != nil:
+		return msg.Document.FileID
+	case len(msg.Photo) > 0:
+		return msg.Photo[len(msg.Photo)-1].FileID
+	}
+	return ""
+}
+
+// downloadMedia returns post with every media Telegram would be sent by URL
+// downloaded, picking the variants that fit the upload limit.
+func (t *TelegramChannelImpl) downloadMedia(ctx context.Context, post model.Post) (model.Post, error) {
+	media := make([]model.Media, 0, len(post.Media))
+	for _, m := range post.Media {
+		if len(media) == maxMediaGroupSize {
+			break
+		}
+		if len(m.Data) > 0 {
+			media = append(media, m)
+			continue
+		}
+		mediaURL, mediaType, ok := m.ForTelegram(t.maxUploadBytes)
+		if !ok {
+			continue
+		}
+
+		file, err := t.downloader.Get(ctx, mediaURL, post.URL)
+		if err != nil {
+			return post, err
+		}
+		media = append(media, model.Media{
+			Type:     mediaType,
+			URL:      mediaURL,
+			Width:    m.Width,
+			Height:   m.Height,
+			Duration: m.Duration,
+			Title:    m.Title,
+			Data:     file.Data,
+			FileName: file.Name,
+		})
+	}
+	post.Media = media
+	return post, nil
+}
+
+// fetchErrors are the Bot API errors returned when Telegram cannot download
+// a file sent by URL.
+var fetchErrors = []string{
+	"failed to get http url content",
+	"wrong file identifier/http url specified",
+	"wrong type of the web page content",
+	"webpage_curl_failed",
+	"webpage_media_empty",
+}
+
+// isFetchError reports whether err means Telegram could not fetch a URL, as
+// opposed to rejecting the message itself.
+func isFetchError(err error) bool {
+	var apiErr *telegoapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	description := strings.ToLower(apiErr.Description)
+	for _, fetchErr := range fetchErrors {
+		if strings.Contains(description, fetchErr) {
+			return true
+		}
+	}
+	return false
+}
+
+// replyToMessageID returns the message to reply to, or zero for a standalone
+// message. Originals that are about to be deleted are never replied to.
+func replyToMessageID(message *telego.Message, chat settings.Chat) int {
+	if chat.Standalone || chat.DeleteOriginal {
+		return 0
+	}
+	return message.MessageID
+}
+
+// inputFile reuses the file already on Telegram servers, uploads the media
+// data when it was already downloaded and lets Telegram fetch mediaURL
+// otherwise.
+func inputFile(media model.Media, mediaURL string) telego.InputFile {
+	if media.FileID != "" {
+		return telego.InputFile{FileID: media.FileID}
+	}
+	if len(media.Data) > 0 {
+		return telego.InputFile{File: tu.NameReader(bytes.NewReader(media.Data), media.FileName)}
+	}
+	return telego.InputFile{URL: mediaURL}
+}
+
+func sendSingle(ctx context.Context, bot *telego.Bot, chatID telego.ChatID, replyTo int, media telego.InputMedia) (*telego.Message, error) {
+	switch m := media.(type) {
+	case *telego.InputMediaVideo:
+		return traceTelegram(ctx, "sendVideo", func() (*telego.Message, error) {
+			return bot.SendVideo(&telego.SendVideoParams{
+				ChatID:           chatID,
+				Video:            m.Media,
+				Caption:          m.Caption,
+				ParseMode:        m.ParseMode,
+				HasSpoiler:       m.HasSpoiler,
+				ReplyToMessageID: replyTo,
+			})
+		})
+	case *telego.InputMediaPhoto:
+		return traceTelegram(ctx, "sendPhoto", func() (*telego.Message, error) {
+			return bot.SendPhoto(&telego.SendPhotoParams{
+				ChatID:           chatID,
+				Photo:            m.Media,
+				Caption:          m.Caption,
+				ParseMode:        m.ParseMode,
+				HasSpoiler:       m.HasSpoiler,
+				ReplyToMessageID: replyTo,
+			})
+		})
+	case *telego.InputMediaAudio:
+		return traceTelegram(ctx, "sendAudio", func() (*telego.Message, error) {
+			return bot.SendAudio(&telego.SendAudioParams{
+				ChatID:           chatID,
+				Audio:            m.Media,
+				Caption:          m.Caption,
+				ParseMode:        m.ParseMode,
+				Duration:         m.Duration,
+				Title:            m.Title,
+				ReplyToMessageID: replyTo,
+			})
+		})
+	}
+	return nil, fmt.Errorf("unsupported media type %q", media.MediaType())
+}
+
+// traceTelegram records a span for the Bot API call made by call. telego
+// takes no context, so the span is opened around the call instead of by the
+// HTTP client.
+func traceTelegram[T any](ctx context.Context, method string, call func() (T, error)) (T, error) {
+	_, span := tracing.Start(ctx, "telegram "+method, attribute.String("telegram.method", method))
+	res, err := call()
+	tracing.End(span, err)
+	return res, err
+}
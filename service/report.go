@@ -0,0 +1,124 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Outcome is what happened to a single link of an update.
+type Outcome string
+
+const (
+	// OutcomePosted is for links whose post was sent.
+	OutcomePosted Outcome = "posted"
+	// OutcomeSkipped is for links handled without sending anything, such
+	// as posts hidden by the NSFW setting or explained by a notice.
+	OutcomeSkipped Outcome = "skipped"
+	// OutcomeThrottled is for links dropped by the rate limits.
+	OutcomeThrottled Outcome = "throttled"
+	// OutcomeFailed is for links whose post could not be fetched or sent.
+	OutcomeFailed Outcome = "failed"
+)
+
+// LinkResult is the outcome of a single link.
+type LinkResult struct {
+	URL      string
+	Provider string
+	Outcome  Outcome
+	Err      error
+}
+
+// LinkError is the error of a failed link.
+type LinkError struct {
+	URL      string
+	Provider string
+	Err      error
+}
+
+func (e *LinkError) Error() string {
+	return fmt.Sprintf("%s link %s: %v", e.Provider, e.URL, e.Err)
+}
+
+func (e *LinkError) Unwrap() error {
+	return e.Err
+}
+
+// Report sums up the links of an update. It is logged as a zap object.
+type Report struct {
+	UpdateID int
+	ChatID   int64
+	// CorrelationID is shared by the log lines of the update.
+	CorrelationID string
+	// TraceID is the trace of the update, empty when it was not traced.
+	TraceID string
+	Links   []LinkResult
+}
+
+// Err joins the errors of the failed links into a *LinkError each, or
+// returns nil when none failed.
+func (r *Report) Err() error {
+	var errs []error
+	for _, link := range r.Links {
+		if link.Err != nil {
+			errs = append(errs, &LinkError{URL: link.URL, Provider: link.Provider, Err: link.Err})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Count returns the number of links with outcome.
+func (r *Report) Count(outcome Outcome) int {
+	n := 0
+	for _, link := range r.Links {
+		if link.Outcome == outcome {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *Report) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddInt("update_id", r.UpdateID)
+	enc.AddInt64("chat_id", r.ChatID)
+	enc.AddString("correlation_id", r.CorrelationID)
+	if r.TraceID != "" {
+		enc.AddString("trace_id", r.TraceID)
+	}
+	for _, outcome := range []Outcome{OutcomePosted, OutcomeSkipped, OutcomeThrottled, OutcomeFailed} {
+		enc.AddInt(string(outcome), r.Count(outcome))
+	}
+	return enc.AddArray("links", zapcore.ArrayMarshalerFunc(func(arr zapcore.ArrayEncoder) error {
+		for _, link := range r.Links {
+			link := link
+			err := arr.AppendObject(zapcore.ObjectMarshalerFunc(func(obj zapcore.ObjectEncoder) error {
+				obj.AddString("url", link.URL)
+				obj.AddString("provider", link.Provider)
+				obj.AddString("outcome", string(link.Outcome))
+				if link.Err != nil {
+					obj.AddString("error", link.Err.Error())
+				}
+				return nil
+			}))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
+
+// LogReport logs the summary of an update, as a warning when links failed.
+// Nil reports, for updates without links, are not logged.
+func LogReport(logger *zap.Logger, report *Report) {
+	if report == nil {
+		return
+	}
+	if report.Count(OutcomeFailed) > 0 {
+		logger.Warn("update processed with failures", zap.Object("report", report))
+		return
+	}
+	logger.Info("update processed", zap.Object("report", report))
+}
@@ -1,89 +1,499 @@
 package service
 
 import (
-	"os"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
 	"strconv"
-	"strings"
+	"sync"
+	"thumb-bot/access"
+	"thumb-bot/config"
+	"thumb-bot/filecache"
+	"thumb-bot/infra/breaker"
+	"thumb-bot/infra/cache"
+	"thumb-bot/infra/dedup"
+	"thumb-bot/infra/download"
+	"thumb-bot/infra/httpclient"
+	"thumb-bot/infra/logs"
+	"thumb-bot/infra/metrics"
+	"thumb-bot/infra/ratelimit"
+	"thumb-bot/infra/tracing"
+	"thumb-bot/model"
+	"thumb-bot/settings"
+	"thumb-bot/utils"
+	"time"
 
 	"github.com/mymmrac/telego"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 )
 
-func NewTelegramService(logger *zap.Logger, bot *telego.Bot) *TelegramChannelImpl {
+func NewTelegramService(logger *zap.Logger, bot *telego.Bot, cfg config.Config, opts ...Option) *TelegramChannelImpl {
 	tc := &TelegramChannelImpl{
-		logger: logger,
-		bot:    bot,
+		logger:   logger,
+		bot:      bot,
+		dedup:    dedup.NewMemoryStore(),
+		settings: settings.NewMemoryStore(),
+
+		accessStore: access.NewMemoryStore(),
+		ownerIDs:    make(map[int64]struct{}),
+
+		maxLinksPerMessage: cfg.Limits.MaxLinksPerMessage,
+		maxMediaBytes:      cfg.Limits.MaxMediaBytes,
+		maxUploadBytes:     cfg.Limits.MaxUploadBytes,
+		fileCache:          filecache.NewMemoryStore(cfg.FileCache.TTL.Std(), cfg.FileCache.MaxEntries),
+		dedupTTL:           cfg.Dedup.TTL.Std(),
+		updateTimeout:      cfg.Limits.UpdateTimeout.Std(),
+		userLimiter:        ratelimit.New(ratelimit.Limit(cfg.RateLimit.User)),
+		chatLimiter:        ratelimit.New(ratelimit.Limit(cfg.RateLimit.Chat)),
+		errorReplyLimiter:  ratelimit.New(ratelimit.Limit(cfg.RateLimit.ErrorReplies)),
+		providerCache: cache.Config[*model.Post]{
+			TTL:         cfg.ProviderCache.TTL.Std(),
+			NegativeTTL: cfg.ProviderCache.NegativeTTL.Std(),
+			MaxEntries:  cfg.ProviderCache.MaxEntries,
+			LoadTimeout: cfg.Limits.UpdateTimeout.Std(),
+		},
+	}
+
+	for _, opt := range opts {
+		opt(tc)
 	}
 
-	tc.initBlacklistFromEnv()
+	for _, id := range cfg.OwnerIDs {
+		tc.ownerIDs[id] = struct{}{}
+	}
+
+	if tc.httpClients == nil {
+		tc.initHTTPClients(cfg.HTTPClient, ratelimit.Limit(cfg.RateLimit.Host))
+	}
+	tc.downloader = download.NewDownloader(
+		tc.httpClients.Client("download",
+			httpclient.WithMaxBodyBytes(cfg.Limits.MaxUploadBytes+1),
+			httpclient.WithTimeout(cfg.Limits.UploadTimeout.Std()),
+		),
+		cfg.Limits.MaxUploadBytes,
+		cfg.Limits.UploadTimeout.Std(),
+	)
+	tc.initRegistry(cfg)
+	tc.initAccessList(cfg.UserBlacklist)
 
 	return tc
 }
 
 type TelegramChannelImpl struct {
-	logger            *zap.Logger
-	bot               *telego.Bot
-	blacklistedUserID map[int64]struct{}
+	logger   *zap.Logger
+	bot      *telego.Bot
+	registry *Registry
+	dedup    dedup.Store
+	settings settings.Store
+
+	accessStore access.Store
+	access      *access.List
+	ownerIDs    map[int64]struct{}
+
+	maxLinksPerMessage int
+	maxMediaBytes      int64
+	maxUploadBytes     int64
+	fileCache          filecache.Store
+	httpClients        *httpclient.Factory
+	downloader         *download.Downloader
+	dedupTTL           time.Duration
+	updateTimeout      time.Duration
+	userLimiter        *ratelimit.Limiter
+	chatLimiter        *ratelimit.Limiter
+	errorReplyLimiter  *ratelimit.Limiter
+	providerCache      cache.Config[*model.Post]
+
+	usernameOnce sync.Once
+	username     string
+}
+
+// initHTTPClients makes the outbound HTTP clients from cfg. An invalid proxy
+// is left out rather than failing the bot, though config.Validate rejects
+// one before it gets here.
+func (t *TelegramChannelImpl) initHTTPClients(cfg config.HTTPClient, hostLimit ratelimit.Limit) {
+	clientCfg := httpclient.Config{
+		Timeout:      cfg.Timeout.Std(),
+		UserAgent:    cfg.UserAgent,
+		Proxy:        cfg.Proxy,
+		MaxBodyBytes: cfg.MaxBodyBytes,
+		HostLimit:    hostLimit,
+	}
+	factory, err := httpclient.NewFactory(t.logger, clientCfg)
+	if err != nil {
+		t.logger.Error("ignoring outbound proxy", zap.Error(err))
+		clientCfg.Proxy = ""
+		factory, _ = httpclient.NewFactory(t.logger, clientCfg)
+	}
+	t.httpClients = factory
 }
 
-func (t *TelegramChannelImpl) initBlacklistFromEnv() {
-	raw := os.Getenv("TELEGRAM_USER_BLACKLIST")
-	if raw == "" {
+// initRegistry registers the default providers except the disabled ones.
+func (t *TelegramChannelImpl) initRegistry(cfg config.Config) {
+	disabled := cfg.DisabledProviders()
+	skip := make(map[string]struct{}, len(disabled))
+	for _, name := range disabled {
+		skip[name] = struct{}{}
+	}
+
+	t.registry = NewRegistry()
+	for _, p := range defaultProviders(t.logger, t.httpClients, cfg) {
+		if _, off := skip[p.Name()]; off {
+			t.logger.Info("provider disabled by configuration", zap.String("provider", p.Name()))
+			delete(skip, p.Name())
+			continue
+		}
+		guarded := newBreakerProvider(t.logger, p, breaker.New(cfg.Breaker.Failures, cfg.Breaker.Cooldown.Std()))
+		t.registry.Register(newCachingProvider(instrumentedProvider{guarded}, t.providerCache))
+	}
+	for name := range skip {
+		t.logger.Warn("unknown provider in configuration", zap.String("provider", name))
+	}
+}
+
+// initAccessList loads the persisted ban and allow lists and seeds them with
+// the configured user blacklist.
+func (t *TelegramChannelImpl) initAccessList(seed []int64) {
+	list, err := access.NewList(t.accessStore)
+	if err != nil {
+		t.logger.Error("failed to load access lists, changes will not be persisted", zap.Error(err))
+		list, _ = access.NewList(access.NewMemoryStore())
+	}
+	t.access = list
+
+	if len(seed) == 0 {
 		return
 	}
+	if err := t.access.Seed(seed); err != nil {
+		t.logger.Warn("failed to persist telegram user blacklist seed", zap.Error(err))
+	}
+	t.logger.Info("telegram user blacklist initialized", zap.Int("count", len(seed)))
+}
 
-	ids := make(map[int64]struct{})
-	for _, part := range strings.Split(raw, ",") {
-		part = strings.TrimSpace(part)
-		if part == "" {
+// isDuplicate reports whether the update, or the message it carries, was
+// already processed. Telegram redelivers webhook updates and a restarted
+// poller may fetch the same update again.
+func (t *TelegramChannelImpl) isDuplicate(ctx context.Context, update telego.Update) bool {
+	duplicate := false
+	for _, key := range dedupKeys(update) {
+		seen, err := t.dedup.Seen(key, t.dedupTTL)
+		if err != nil {
+			logs.FromContext(ctx, t.logger).Warn("failed to check update de-duplication", zap.String("key", key), zap.Error(err))
 			continue
 		}
-		if id, err := strconv.ParseInt(part, 10, 64); err == nil {
-			ids[id] = struct{}{}
-		} else {
-			t.logger.Warn("invalid user id in TELEGRAM_USER_BLACKLIST", zap.String("value", part), zap.Error(err))
+		duplicate = duplicate || seen
+	}
+	return duplicate
+}
+
+// forgetUpdate lets a redelivery of update be processed again.
+func (t *TelegramChannelImpl) forgetUpdate(ctx context.Context, update telego.Update) {
+	for _, key := range dedupKeys(update) {
+		if err := t.dedup.Forget(key); err != nil {
+			logs.FromContext(ctx, t.logger).Warn("failed to clear update de-duplication", zap.String("key", key), zap.Error(err))
 		}
 	}
+}
 
-	if len(ids) > 0 {
-		t.blacklistedUserID = ids
-		t.logger.Info("telegram user blacklist initialized", zap.Int("count", len(ids)))
+func dedupKeys(update telego.Update) []string {
+	keys := []string{fmt.Sprintf("update:%d", update.UpdateID)}
+	if update.Message != nil {
+		keys = append(keys, fmt.Sprintf("message:%d:%d", update.Message.Chat.ID, update.Message.MessageID))
 	}
+	return keys
 }
 
-func (t *TelegramChannelImpl) isUserBlacklisted(update telego.Update) bool {
-	if t.blacklistedUserID == nil {
+// isServed reports whether the bot answers message, given the banned users
+// and the banned or allowed chats.
+func (t *TelegramChannelImpl) isServed(ctx context.Context, message *telego.Message) bool {
+	logger := logs.FromContext(ctx, t.logger)
+	if message.From != nil && t.access.UserBanned(message.From.ID) {
+		logger.Info("ignoring update from blacklisted user", zap.Int64(logs.UserIDKey, message.From.ID))
 		return false
 	}
-
-	if update.Message == nil || update.Message.From == nil {
+	if !t.access.ChatServed(message.Chat.ID) {
+		logger.Info("ignoring update from chat that is not served")
 		return false
 	}
+	return true
+}
+
+// ProcessMedia handles one update. Fetches and downloads stop when ctx is
+// done or after the per-update timeout.
+//
+// Links are handled independently: a failing link does not stop the others.
+// The returned report, nil for updates without links to handle, tells what
+// happened to each of them, and the error joins a *LinkError per failed link.
+func (t *TelegramChannelImpl) ProcessMedia(ctx context.Context, update telego.Update) (report *Report, err error) {
+	ctx, span := tracing.Start(ctx, "update", attribute.Int("update_id", update.UpdateID))
+	defer func() { tracing.End(span, err) }()
+
+	if update.Message == nil || update.Message.Text == "" {
+		return nil, nil
+	}
+	message := update.Message
+	span.SetAttributes(attribute.Int64("chat_id", message.Chat.ID))
+	ctx = logs.ForUpdate(ctx, t.logger, update.UpdateID, message.Chat.ID)
+	logger := logs.FromContext(ctx, t.logger)
+
+	if t.isDuplicate(ctx, update) {
+		logger.Info("ignoring duplicate update")
+		return nil, nil
+	}
+
+	// Owners manage the access lists from any chat, even one not served
+	if isCommand(message) && t.isOwner(message) {
+		return nil, t.handleCommand(ctx, message)
+	}
+
+	if !t.isServed(ctx, message) {
+		return nil, nil
+	}
+
+	if isCommand(message) {
+		return nil, t.handleCommand(ctx, message)
+	}
+
+	chat, err := t.settings.Get(message.Chat.ID)
+	if err != nil {
+		logger.Warn("failed to load chat settings, using defaults", zap.Error(err))
+	}
+
+	links := t.messageLinks(ctx, message.Text, chat)
+	if len(links) == 0 {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.updateTimeout)
+	defer cancel()
+
+	report = &Report{UpdateID: update.UpdateID, ChatID: message.Chat.ID}
+	report.CorrelationID = logs.CorrelationID(ctx)
+	if sc := span.SpanContext(); sc.IsValid() {
+		report.TraceID = sc.TraceID().String()
+	}
+	throttled := false
+	for _, link := range links {
+		result := LinkResult{URL: link.String()}
+		if provider, ok := t.registry.Lookup(link); ok {
+			result.Provider = provider.Name()
+		}
+		metrics.LinksDetected.WithLabelValues(result.Provider).Inc()
+
+		switch {
+		case ctx.Err() != nil:
+			result.Outcome, result.Err = OutcomeFailed, ctx.Err()
+		case throttled || !t.allowLink(ctx, message):
+			if !throttled {
+				t.notifyThrottled(ctx, message)
+				throttled = true
+			}
+			result.Outcome = OutcomeThrottled
+		default:
+			linkCtx, linkSpan := tracing.Start(ctx, "link",
+				attribute.String("provider", result.Provider),
+				attribute.String("url", result.URL),
+			)
+			posted, err := t.processLink(linkCtx, message, link, chat)
+			tracing.End(linkSpan, err)
+			switch {
+			case err != nil:
+				result.Outcome, result.Err = OutcomeFailed, err
+			case posted:
+				result.Outcome = OutcomePosted
+			default:
+				result.Outcome = OutcomeSkipped
+			}
+		}
+		report.Links = append(report.Links, result)
+	}
+
+	// An update cut short by its deadline or a shutdown is processed again
+	// when redelivered, unless some of its links were posted already
+	if ctx.Err() != nil && report.Count(OutcomePosted) == 0 {
+		t.forgetUpdate(ctx, update)
+	}
 
-	_, exists := t.blacklistedUserID[update.Message.From.ID]
-	return exists
+	if report.Count(OutcomePosted) > 0 && chat.DeleteOriginal {
+		_, err := traceTelegram(ctx, "deleteMessage", func() (struct{}, error) {
+			return struct{}{}, t.bot.DeleteMessage(&telego.DeleteMessageParams{
+				ChatID:    telego.ChatID{ID: message.Chat.ID},
+				MessageID: message.MessageID,
+			})
+		})
+		if err != nil {
+			logger.Warn("failed to delete original message", zap.Error(err))
+		}
+	}
+	return report, report.Err()
 }
 
-func (t *TelegramChannelImpl) ProcessMedia(update telego.Update) error {
-	if t.isUserBlacklisted(update) {
-		t.logger.Info("ignoring update from blacklisted user", zap.Int64("user_id", update.Message.From.ID))
-		return nil
+// messageLinks returns the links of a message to distinct posts in the order
+// they appear, capped at maxLinksPerMessage links handled by providers enabled in
+// the chat and producing content it accepts.
+func (t *TelegramChannelImpl) messageLinks(ctx context.Context, text string, chat settings.Chat) []*url.URL {
+	logger := logs.FromContext(ctx, t.logger)
+	var links []*url.URL
+	seen := make(map[string]struct{})
+	accepts := accepted(chat)
+	for _, raw := range utils.ExtractLinks(text) {
+		link, err := url.Parse(raw)
+		if err != nil {
+			logger.Warn("failed to parse link", zap.String("link", raw), zap.Error(err))
+			continue
+		}
+		link.Fragment = ""
+
+		provider, ok := t.registry.Lookup(link)
+		if !ok || !chat.ProviderEnabled(provider.Name()) || provider.Capabilities()&accepts == 0 {
+			continue
+		}
+
+		// Variants of the same post, e.g. x.com and twitter.com links, are
+		// posted once
+		key := provider.Canonical(link)
+		if key == "" {
+			key = link.String()
+		}
+		if _, dup := seen[key]; dup {
+			continue
+		}
+		seen[key] = struct{}{}
+
+		if len(links) == t.maxLinksPerMessage {
+			logger.Info("link limit reached, ignoring remaining links", zap.Int("limit", t.maxLinksPerMessage))
+			break
+		}
+		links = append(links, link)
+	}
+	return links
+}
+
+// processLink sends the post behind link, reporting whether anything was
+// sent. Posts sent before are re-sent from the file_id cache without
+// fetching them again.
+func (t *TelegramChannelImpl) processLink(ctx context.Context, message *telego.Message, link *url.URL, chat settings.Chat) (bool, error) {
+	provider, ok := t.registry.Lookup(link)
+	if !ok {
+		return false, nil
+	}
+
+	ctx = logs.WithProvider(ctx, t.logger, provider.Name())
+	logger := logs.FromContext(ctx, t.logger)
+
+	key := provider.Canonical(link)
+	if key != "" {
+		if sent, ok := t.sendCached(ctx, message, key, chat); ok {
+			return sent, nil
+		}
+	}
+
+	post, err := provider.Fetch(ctx, link)
+	var ne *noticeError
+	if errors.As(err, &ne) {
+		logger.Info(err.Error())
+		t.replyError(ctx, message, chat, ne.text)
+		return false, nil
+	}
+	if err != nil {
+		logger.Error(err.Error())
+		t.replyFailure(ctx, message, chat, provider.Name(), err)
+		return false, err
+	}
+	if post == nil {
+		return false, nil
 	}
 
-	twitterErr := t.processTwitterMedia(update)
-	if twitterErr != nil {
-		t.logger.Error(twitterErr.Error())
-		return twitterErr
+	sent, err := t.renderPost(ctx, message, *post, chat)
+	if err != nil {
+		logger.Error("failed to send post", zap.Error(err))
+		t.replyFailure(ctx, message, chat, provider.Name(), err)
+		return false, err
 	}
-	instagramErr := t.processInstagramMedia(update)
-	if instagramErr != nil {
-		t.logger.Error(instagramErr.Error())
-		return instagramErr
+	if sent == nil {
+		return false, nil
+	}
+
+	if key != "" && cacheable(*sent) {
+		if err := t.fileCache.Put(key, *sent); err != nil {
+			logger.Warn("failed to cache file ids", zap.String("key", key), zap.Error(err))
+		}
+	}
+	return true, nil
+}
+
+// sendCached re-sends the post cached under key, reporting whether it was
+// cached and whether anything was sent. A failed re-send, e.g. for a file_id
+// Telegram no longer accepts, falls back to fetching the post.
+func (t *TelegramChannelImpl) sendCached(ctx context.Context, message *telego.Message, key string, chat settings.Chat) (sent bool, ok bool) {
+	logger := logs.FromContext(ctx, t.logger)
+	post, found, err := t.fileCache.Get(key)
+	if err != nil {
+		logger.Warn("failed to read file id cache", zap.String("key", key), zap.Error(err))
+		return false, false
+	}
+	if !found {
+		return false, false
+	}
+
+	resent, err := t.renderPost(ctx, message, post, chat)
+	if err != nil {
+		logger.Warn("failed to re-send cached post", zap.String("key", key), zap.Error(err))
+		return false, false
+	}
+	logger.Info("re-sent cached post", zap.String("key", key))
+	return resent != nil, true
+}
+
+// cacheable reports whether every media of post got a file_id.
+func cacheable(post model.Post) bool {
+	for _, media := range post.Media {
+		if media.FileID == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// throttleNoticeInterval is how often a throttled user is told so.
+const throttleNoticeInterval = time.Minute
+
+// allowLink takes a token from the buckets of the sender and of the chat,
+// or from neither when one of them is empty.
+func (t *TelegramChannelImpl) allowLink(ctx context.Context, message *telego.Message) bool {
+	logger := logs.FromContext(ctx, t.logger)
+	userKey := ""
+	if message.From != nil {
+		userKey = strconv.FormatInt(message.From.ID, 10)
+		if !t.userLimiter.Allow(userKey) {
+			logger.Info("user rate limited", zap.Int64(logs.UserIDKey, message.From.ID))
+			return false
+		}
+	}
+	if !t.chatLimiter.Allow(strconv.FormatInt(message.Chat.ID, 10)) {
+		// A busy chat must not use up the sender's quota elsewhere
+		if userKey != "" {
+			t.userLimiter.Refund(userKey)
+		}
+		logger.Info("chat rate limited")
+		return false
+	}
+	return true
+}
+
+// notifyThrottled replies once per throttleNoticeInterval to a throttled
+// sender, so the notices do not become a flood of their own.
+func (t *TelegramChannelImpl) notifyThrottled(ctx context.Context, message *telego.Message) {
+	var userID int64
+	if message.From != nil {
+		userID = message.From.ID
+	}
+	notified, err := t.dedup.Seen(fmt.Sprintf("throttled:%d:%d", message.Chat.ID, userID), throttleNoticeInterval)
+	if err != nil || notified {
+		return
 	}
-	youtubeErr := t.processYouTubeMedia(update)
-	if youtubeErr != nil {
-		t.logger.Error(youtubeErr.Error())
-		return youtubeErr
+	if err := t.replyText(ctx, message, "Too many links in a short time, please wait a minute before sending more."); err != nil {
+		logs.FromContext(ctx, t.logger).Warn("failed to send throttle notice", zap.Error(err))
 	}
-	return nil
 }
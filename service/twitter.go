@@ -1,15 +1,16 @@
 package service
 
 import (
-	"fmt"
+	"context"
 	"net/http"
 	"net/url"
 	"strings"
+	"thumb-bot/infra/logs"
+	"thumb-bot/infra/metrics"
 	"thumb-bot/integration/fxtwitter"
 	"thumb-bot/integration/vxtwitter"
-	"thumb-bot/utils"
+	"thumb-bot/model"
 
-	"github.com/mymmrac/telego"
 	"go.uber.org/zap"
 )
 
@@ -22,178 +23,95 @@ var twitterHosts = []string{
 	"www.x.com",
 }
 
-func (t *TelegramChannelImpl) processTwitterMedia(update telego.Update) error {
-	if update.Message == nil || update.Message.Text == "" {
-		return nil
-	}
+type twitterProvider struct {
+	logger    *zap.Logger
+	fxtwitter *fxtwitter.Client
+	vxtwitter *vxtwitter.Client
+	// shortener must not follow redirects, so t.co links can be expanded
+	shortener *http.Client
+}
 
-	payload := update.Message.Text
-	links := utils.ExtractLinks(payload)
-	if len(links) == 0 {
-		return nil
-	}
+func newTwitterProvider(logger *zap.Logger, fx *fxtwitter.Client, vx *vxtwitter.Client, shortener *http.Client) *twitterProvider {
+	return &twitterProvider{logger: logger, fxtwitter: fx, vxtwitter: vx, shortener: shortener}
+}
 
-	if strings.Contains(links[0], "t.co") {
-		links[0], _ = expandShortURL(links[0])
-	}
+func (p *twitterProvider) Name() string {
+	return "twitter"
+}
 
-	twUrl, err := url.Parse(links[0])
-	if err != nil {
-		t.logger.Error("failed to parse twUrl", zap.Error(err))
-		return err
-	}
+func (p *twitterProvider) Hosts() []string {
+	return twitterHosts
+}
 
-	for _, host := range twitterHosts {
-		if twUrl.Host == host {
-			t.logger.Info("fetching tweet", zap.String("twUrl", twUrl.String()))
-
-			// Try fxtwitter first
-			fxResponse, fxErr := fxtwitter.Fetch(twUrl.Path)
-			if fxErr == nil && fxResponse.Code == 200 {
-				t.logger.Info("using fxtwitter provider")
-				return t.processFxtwitterResponse(update, fxResponse)
-			}
-
-			// Fallback to vxtwitter
-			t.logger.Info("fxtwitter failed, trying vxtwitter", zap.Error(fxErr))
-			vxResponse, vxErr := vxtwitter.Fetch(twUrl.Path)
-			if vxErr != nil {
-				t.logger.Error("both fxtwitter and vxtwitter failed", zap.Error(vxErr))
-				return vxErr
-			}
-
-			t.logger.Info("using vxtwitter provider")
-			return t.processVxtwitterResponse(update, vxResponse)
-		}
-	}
-	return nil
+func (p *twitterProvider) Priority() int {
+	return 30
 }
 
-func expandShortURL(shortURL string) (string, error) {
-	client := &http.Client{
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
-	}
-	resp, err := client.Head(shortURL)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-	return resp.Header.Get("Location"), nil
+func (p *twitterProvider) Capabilities() Capability {
+	return CapabilityText | CapabilityPhoto | CapabilityVideo | CapabilityMediaGroup
 }
 
-func (t *TelegramChannelImpl) processFxtwitterResponse(update telego.Update, response fxtwitter.Response) error {
-	if response.Tweet.Media != nil && len(response.Tweet.Media.All) > 0 {
-		var mediaGroup []telego.InputMedia
-		for i, media := range response.Tweet.Media.All {
-			// Use the new variant selection logic
-			bestUrl, mediaType, found := fxtwitter.GetBestMediaForTelegram(media)
-			if !found {
-				continue
-			}
-
-			mediaUrl := utils.RemoveQueryParams(bestUrl)
-			caption := ""
-			if i == 0 {
-				caption = fmt.Sprintf("%s\n\n%s: %s\n\n💟 %d 🔁 %d", response.Tweet.URL, response.Tweet.Author.ScreenName, response.Tweet.Text, response.Tweet.Likes, response.Tweet.Retweets)
-			}
-
-			switch mediaType {
-			case "video":
-				mediaGroup = append(mediaGroup, &telego.InputMediaVideo{
-					Media:     telego.InputFile{URL: mediaUrl},
-					Caption:   caption,
-					ParseMode: "HTML",
-					Type:      "video",
-				})
-			case "photo":
-				mediaGroup = append(mediaGroup, &telego.InputMediaPhoto{
-					Media:     telego.InputFile{URL: mediaUrl},
-					Caption:   caption,
-					ParseMode: "HTML",
-					Type:      "photo",
-				})
-			}
+func (p *twitterProvider) Canonical(u *url.URL) string {
+	// /<user>/status/<id>, /i/status/<id> and /i/web/status/<id>
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for i := 0; i+1 < len(parts); i++ {
+		if parts[i] == "status" && parts[i+1] != "" {
+			return "https://twitter.com/i/status/" + parts[i+1]
 		}
+	}
+	return ""
+}
 
-		if len(mediaGroup) > 0 {
-			_, err := t.bot.SendMediaGroup(&telego.SendMediaGroupParams{
-				ChatID:           telego.ChatID{ID: update.Message.Chat.ID},
-				Media:            mediaGroup,
-				ReplyToMessageID: update.Message.MessageID,
-			})
-			if err != nil {
-				t.logger.Error("failed to send media group", zap.Error(err))
-				return err
-			}
+func (p *twitterProvider) Fetch(ctx context.Context, twUrl *url.URL) (*model.Post, error) {
+	logger := logs.FromContext(ctx, p.logger)
+	if twUrl.Host == "t.co" {
+		expanded, err := p.expandShortURL(ctx, twUrl.String())
+		if err != nil {
+			return nil, err
 		}
-	} else if response.Tweet.Text != "" {
-		message := fmt.Sprintf("%s\n\n%s: %s", response.Tweet.URL, response.Tweet.Author.ScreenName, response.Tweet.Text)
-		_, err := t.bot.SendMessage(&telego.SendMessageParams{
-			ChatID:           telego.ChatID{ID: update.Message.Chat.ID},
-			Text:             message,
-			ParseMode:        "HTML",
-			ReplyToMessageID: update.Message.MessageID,
-		})
+		twUrl, err = url.Parse(expanded)
 		if err != nil {
-			t.logger.Error("failed to send message", zap.Error(err))
-			return err
+			logger.Error("failed to parse twUrl", zap.Error(err))
+			return nil, err
+		}
+		if twUrl.Host == "t.co" || !matchHost(twitterHosts, twUrl) {
+			return nil, nil
 		}
 	}
-	return nil
-}
 
-func (t *TelegramChannelImpl) processVxtwitterResponse(update telego.Update, response vxtwitter.Response) error {
-	if len(response.MediaExtended) > 0 {
-		var mediaGroup []telego.InputMedia
-		for i, media := range response.MediaExtended {
-			mediaUrl := utils.RemoveQueryParams(media.URL)
-			caption := ""
-			if i == 0 {
-				caption = fmt.Sprintf("%s\n\n%s: %s\n\n💟 %d 🔁 %d", response.TweetURL, response.UserScreenName, response.Text, response.Likes, response.Retweets)
-			}
-			switch media.Type {
-			case "video":
-				mediaGroup = append(mediaGroup, &telego.InputMediaVideo{
-					Media:     telego.InputFile{URL: mediaUrl},
-					Caption:   caption,
-					ParseMode: "HTML",
-					Type:      "video",
-				})
-			case "image":
-				mediaGroup = append(mediaGroup, &telego.InputMediaPhoto{
-					Media:     telego.InputFile{URL: mediaUrl},
-					Caption:   caption,
-					ParseMode: "HTML",
-					Type:      "photo",
-				})
-			}
-		}
+	logger.Info("fetching tweet", zap.String("twUrl", twUrl.String()))
 
-		if len(mediaGroup) > 0 {
-			_, err := t.bot.SendMediaGroup(&telego.SendMediaGroupParams{
-				ChatID:           telego.ChatID{ID: update.Message.Chat.ID},
-				Media:            mediaGroup,
-				ReplyToMessageID: update.Message.MessageID,
-			})
-			if err != nil {
-				t.logger.Error("failed to send media group", zap.Error(err))
-				return err
-			}
-		}
-	} else if response.Text != "" {
-		message := fmt.Sprintf("%s\n\n%s: %s", response.TweetURL, response.UserScreenName, response.Text)
-		_, err := t.bot.SendMessage(&telego.SendMessageParams{
-			ChatID:           telego.ChatID{ID: update.Message.Chat.ID},
-			Text:             message,
-			ParseMode:        "HTML",
-			ReplyToMessageID: update.Message.MessageID,
-		})
-		if err != nil {
-			t.logger.Error("failed to send message", zap.Error(err))
-			return err
-		}
+	// Try fxtwitter first
+	fxResponse, fxErr := p.fxtwitter.Fetch(ctx, twUrl.Path)
+	if fxErr == nil && fxResponse.Code == 200 {
+		logger.Info("using fxtwitter provider")
+		post := fxResponse.ToPost()
+		return &post, nil
+	}
+
+	// Fallback to vxtwitter
+	logger.Info("fxtwitter failed, trying vxtwitter", zap.Error(fxErr))
+	metrics.TwitterFallbacks.Inc()
+	vxResponse, vxErr := p.vxtwitter.Fetch(ctx, twUrl.Path)
+	if vxErr != nil {
+		logger.Error("both fxtwitter and vxtwitter failed", zap.Error(vxErr))
+		return nil, vxErr
 	}
-	return nil
+
+	logger.Info("using vxtwitter provider")
+	post := vxResponse.ToPost()
+	return &post, nil
+}
+
+func (p *twitterProvider) expandShortURL(ctx context.Context, shortURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, shortURL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := p.shortener.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	return resp.Header.Get("Location"), nil
 }
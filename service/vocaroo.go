@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"thumb-bot/infra/logs"
+	"thumb-bot/integration/vocaroo"
+	"thumb-bot/model"
+	"thumb-bot/utils"
+
+	"go.uber.org/zap"
+)
+
+var vocarooHosts = []string{
+	"vocaroo.com",
+	"www.vocaroo.com",
+	"voca.ro",
+}
+
+type vocarooProvider struct {
+	logger *zap.Logger
+	client *vocaroo.Client
+}
+
+func newVocarooProvider(logger *zap.Logger, client *vocaroo.Client) *vocarooProvider {
+	return &vocarooProvider{logger: logger, client: client}
+}
+
+func (p *vocarooProvider) Name() string {
+	return "vocaroo"
+}
+
+func (p *vocarooProvider) Hosts() []string {
+	return vocarooHosts
+}
+
+func (p *vocarooProvider) Priority() int {
+	return 5
+}
+
+func (p *vocarooProvider) Capabilities() Capability {
+	return CapabilityAudio
+}
+
+func (p *vocarooProvider) Canonical(u *url.URL) string {
+	shortCode, err := vocaroo.Shortcode(u.String())
+	if err != nil {
+		return ""
+	}
+	return "https://voca.ro/" + shortCode
+}
+
+func (p *vocarooProvider) Fetch(ctx context.Context, vocarooURL *url.URL) (*model.Post, error) {
+	logger := logs.FromContext(ctx, p.logger)
+	logger.Info("fetching Vocaroo recording", zap.String("vocarooURL", vocarooURL.String()))
+
+	recording, err := p.client.Fetch(ctx, vocarooURL.String())
+	switch {
+	case errors.Is(err, vocaroo.ErrExpired):
+		return nil, notice("This Vocaroo recording has expired or was deleted.", err)
+	case errors.Is(err, vocaroo.ErrTooLarge):
+		return nil, notice("This Vocaroo recording is too large to upload.", err)
+	case err != nil:
+		logger.Error("failed to fetch Vocaroo recording", zap.Error(err))
+		return nil, err
+	}
+
+	post := recording.ToPost(utils.RemoveQueryParams(vocarooURL.String()))
+	return &post, nil
+}
@@ -1,12 +1,13 @@
 package service
 
 import (
-	"fmt"
+	"context"
 	"net/url"
+	"thumb-bot/infra/logs"
 	"thumb-bot/integration/youtube"
+	"thumb-bot/model"
 	"thumb-bot/utils"
 
-	"github.com/mymmrac/telego"
 	"go.uber.org/zap"
 )
 
@@ -18,84 +19,57 @@ var youtubeHosts = []string{
 	"www.youtu.be",
 }
 
-func (t *TelegramChannelImpl) processYouTubeMedia(update telego.Update) error {
-	if update.Message == nil || update.Message.Text == "" {
-		return nil
-	}
+type youtubeProvider struct {
+	logger *zap.Logger
+	client *youtube.Client
+}
 
-	payload := update.Message.Text
-	links := utils.ExtractLinks(payload)
-	if len(links) == 0 {
-		return nil
-	}
+func newYouTubeProvider(logger *zap.Logger, client *youtube.Client) *youtubeProvider {
+	return &youtubeProvider{logger: logger, client: client}
+}
 
-	youtubeURL, err := url.Parse(links[0])
-	if err != nil {
-		t.logger.Error("failed to parse youtube URL", zap.Error(err))
-		return err
-	}
+func (p *youtubeProvider) Name() string {
+	return "youtube"
+}
 
-	// Check if it's a YouTube URL
-	isYouTube := false
-	for _, host := range youtubeHosts {
-		if youtubeURL.Host == host {
-			isYouTube = true
-			break
-		}
-	}
+func (p *youtubeProvider) Hosts() []string {
+	return youtubeHosts
+}
 
-	if !isYouTube {
-		return nil
+func (p *youtubeProvider) Priority() int {
+	return 10
+}
+
+func (p *youtubeProvider) Capabilities() Capability {
+	return CapabilityText | CapabilityPhoto
+}
+
+func (p *youtubeProvider) Canonical(u *url.URL) string {
+	videoID, err := youtube.ExtractVideoID(u.String())
+	if err != nil {
+		return ""
 	}
+	return "https://www.youtube.com/watch?v=" + videoID
+}
 
-	t.logger.Info("fetching YouTube video", zap.String("youtubeURL", youtubeURL.String()))
+func (p *youtubeProvider) Fetch(ctx context.Context, youtubeURL *url.URL) (*model.Post, error) {
+	logger := logs.FromContext(ctx, p.logger)
+	logger.Info("fetching YouTube video", zap.String("youtubeURL", youtubeURL.String()))
 
 	// Fetch video information
-	response, err := youtube.Fetch(youtubeURL.String())
+	response, err := p.client.Fetch(ctx, youtubeURL.String())
 	if err != nil {
-		t.logger.Error("failed to fetch YouTube video", zap.Error(err))
-		return err
+		logger.Error("failed to fetch YouTube video", zap.Error(err))
+		return nil, err
 	}
 
 	// Get direct link (normalized YouTube URL)
 	directLink, err := youtube.GetDirectLink(youtubeURL.String())
 	if err != nil {
-		t.logger.Warn("failed to get direct link, using original URL", zap.Error(err))
+		logger.Warn("failed to get direct link, using original URL", zap.Error(err))
 		directLink = utils.RemoveQueryParams(youtubeURL.String())
 	}
 
-	// Create caption with title, author, and direct link
-	caption := fmt.Sprintf("%s\n\n%s", directLink, response.Title)
-	if response.AuthorName != "" {
-		caption = fmt.Sprintf("%s\n\n%s: %s", directLink, response.AuthorName, response.Title)
-	}
-
-	// Send thumbnail as photo with caption
-	if response.ThumbnailURL != "" {
-		_, err := t.bot.SendPhoto(&telego.SendPhotoParams{
-			ChatID:           telego.ChatID{ID: update.Message.Chat.ID},
-			Photo:            telego.InputFile{URL: response.ThumbnailURL},
-			Caption:          caption,
-			ParseMode:        "HTML",
-			ReplyToMessageID: update.Message.MessageID,
-		})
-		if err != nil {
-			t.logger.Error("failed to send YouTube thumbnail", zap.Error(err))
-			return err
-		}
-	} else {
-		// Fallback: send text message if no thumbnail
-		_, err := t.bot.SendMessage(&telego.SendMessageParams{
-			ChatID:           telego.ChatID{ID: update.Message.Chat.ID},
-			Text:             caption,
-			ParseMode:        "HTML",
-			ReplyToMessageID: update.Message.MessageID,
-		})
-		if err != nil {
-			t.logger.Error("failed to send YouTube message", zap.Error(err))
-			return err
-		}
-	}
-
-	return nil
+	post := response.ToPost(directLink)
+	return &post, nil
 }
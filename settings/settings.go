@@ -0,0 +1,190 @@
+package settings
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"thumb-bot/infra/storage"
+)
+
+// CaptionStyle controls how much of the post is written in the caption.
+type CaptionStyle string
+
+const (
+	// CaptionFull shows link, author, text and stats.
+	CaptionFull CaptionStyle = "full"
+	// CaptionCompact shows link and author.
+	CaptionCompact CaptionStyle = "compact"
+	// CaptionLink shows only the link.
+	CaptionLink CaptionStyle = "link"
+)
+
+// NSFWMode controls how posts flagged as sensitive are sent.
+type NSFWMode string
+
+const (
+	NSFWShow    NSFWMode = "show"
+	NSFWSpoiler NSFWMode = "spoiler"
+	NSFWHide    NSFWMode = "hide"
+)
+
+// Media kinds a chat can turn off.
+const (
+	MediaPhoto = "photo"
+	MediaVideo = "video"
+	MediaAudio = "audio"
+)
+
+// Chat holds the settings of a single chat.
+type Chat struct {
+	// DisabledProviders is stored instead of the enabled ones so providers
+	// added later are on by default.
+	DisabledProviders []string `json:"disabled_providers,omitempty"`
+	// DisabledMedia lists the media kinds the chat does not want; links to
+	// providers sending only those are ignored.
+	DisabledMedia []string     `json:"disabled_media,omitempty"`
+	CaptionStyle  CaptionStyle `json:"caption_style"`
+	// Standalone sends posts as new messages instead of replies.
+	Standalone     bool     `json:"standalone"`
+	DeleteOriginal bool     `json:"delete_original"`
+	NSFW           NSFWMode `json:"nsfw"`
+	// ErrorReplies explains in a short reply why a link was not posted.
+	ErrorReplies bool `json:"error_replies"`
+}
+
+// Default returns the settings of a chat that never changed them.
+func Default() Chat {
+	return Chat{
+		CaptionStyle: CaptionFull,
+		NSFW:         NSFWShow,
+	}
+}
+
+func (c Chat) ProviderEnabled(name string) bool {
+	for _, disabled := range c.DisabledProviders {
+		if disabled == name {
+			return false
+		}
+	}
+	return true
+}
+
+// SetProvider enables or disables the provider called name.
+func (c *Chat) SetProvider(name string, enabled bool) {
+	var disabled []string
+	for _, p := range c.DisabledProviders {
+		if p != name {
+			disabled = append(disabled, p)
+		}
+	}
+	if !enabled {
+		disabled = append(disabled, name)
+	}
+	c.DisabledProviders = disabled
+}
+
+func (c Chat) MediaEnabled(kind string) bool {
+	for _, disabled := range c.DisabledMedia {
+		if disabled == kind {
+			return false
+		}
+	}
+	return true
+}
+
+// SetMedia turns the media kind on or off.
+func (c *Chat) SetMedia(kind string, enabled bool) {
+	var disabled []string
+	for _, k := range c.DisabledMedia {
+		if k != kind {
+			disabled = append(disabled, k)
+		}
+	}
+	if !enabled {
+		disabled = append(disabled, kind)
+	}
+	c.DisabledMedia = disabled
+}
+
+func ParseMediaKind(raw string) (string, error) {
+	switch raw {
+	case MediaPhoto, MediaVideo, MediaAudio:
+		return raw, nil
+	default:
+		return "", fmt.Errorf("unknown media kind %q, expected photo, video or audio", raw)
+	}
+}
+
+func ParseCaptionStyle(raw string) (CaptionStyle, error) {
+	switch style := CaptionStyle(raw); style {
+	case CaptionFull, CaptionCompact, CaptionLink:
+		return style, nil
+	default:
+		return "", fmt.Errorf("unknown caption style %q, expected full, compact or link", raw)
+	}
+}
+
+func ParseNSFWMode(raw string) (NSFWMode, error) {
+	switch mode := NSFWMode(raw); mode {
+	case NSFWShow, NSFWSpoiler, NSFWHide:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown nsfw mode %q, expected show, spoiler or hide", raw)
+	}
+}
+
+// Store persists chat settings.
+type Store interface {
+	// Get returns the settings of chatID, or Default when none were saved.
+	Get(chatID int64) (Chat, error)
+	Put(chatID int64, chat Chat) error
+}
+
+const bucket = "chat_settings"
+
+// BoltStore keeps settings in the embedded database.
+type BoltStore struct {
+	db *storage.DB
+}
+
+func NewBoltStore(db *storage.DB) *BoltStore {
+	return &BoltStore{db: db}
+}
+
+func (s *BoltStore) Get(chatID int64) (Chat, error) {
+	chat := Default()
+	if _, err := s.db.Get(bucket, strconv.FormatInt(chatID, 10), &chat); err != nil {
+		return Default(), err
+	}
+	return chat, nil
+}
+
+func (s *BoltStore) Put(chatID int64, chat Chat) error {
+	return s.db.Put(bucket, strconv.FormatInt(chatID, 10), chat)
+}
+
+// MemoryStore keeps settings in memory, e.g. where no writable disk exists.
+type MemoryStore struct {
+	mu    sync.RWMutex
+	chats map[int64]Chat
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{chats: make(map[int64]Chat)}
+}
+
+func (s *MemoryStore) Get(chatID int64) (Chat, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if chat, ok := s.chats[chatID]; ok {
+		return chat, nil
+	}
+	return Default(), nil
+}
+
+func (s *MemoryStore) Put(chatID int64, chat Chat) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.chats[chatID] = chat
+	return nil
+}
@@ -10,6 +10,7 @@ echo -e "\n📡 Testing webhook endpoint..."
 # Test webhook with sample update
 curl -s -X POST http://localhost:3000/webhook \
   -H "Content-Type: application/json" \
+  -H "X-Telegram-Bot-Api-Secret-Token: ${WEBHOOK_SECRET}" \
   -d '{
     "update_id": 123456789,
     "message": {
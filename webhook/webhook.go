@@ -1,6 +1,14 @@
 package webhook
 
 import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+	"thumb-bot/infra/logs"
+	"thumb-bot/infra/metrics"
+	"thumb-bot/infra/queue"
 	"thumb-bot/service"
 
 	"github.com/gofiber/fiber/v2"
@@ -8,21 +16,74 @@ import (
 	"go.uber.org/zap"
 )
 
+// SecretTokenHeader carries the secret token Telegram sends with every webhook request.
+const SecretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// Path is the route the webhook is served on.
+const Path = "/webhook"
+
+// Config describes how the webhook is registered with Telegram.
+type Config struct {
+	// URL is the public base URL of the bot; Path is appended when missing.
+	URL            string
+	SecretToken    string
+	MaxConnections int
+	AllowedUpdates []string
+}
+
+// Register points Telegram at the webhook described by cfg.
+func Register(bot *telego.Bot, cfg Config) error {
+	if cfg.URL == "" {
+		return fmt.Errorf("webhook URL is not set")
+	}
+
+	webhookURL := strings.TrimSuffix(cfg.URL, "/")
+	if !strings.HasSuffix(webhookURL, Path) {
+		webhookURL += Path
+	}
+
+	return bot.SetWebhook(&telego.SetWebhookParams{
+		URL:            webhookURL,
+		MaxConnections: cfg.MaxConnections,
+		AllowedUpdates: cfg.AllowedUpdates,
+		SecretToken:    cfg.SecretToken,
+	})
+}
+
 type WebhookHandler struct {
-	logger  *zap.Logger
-	bot     *telego.Bot
-	service *service.TelegramChannelImpl
+	logger      *zap.Logger
+	bot         *telego.Bot
+	service     *service.TelegramChannelImpl
+	secretToken string
+	queue       *queue.Pool
 }
 
-func NewWebhookHandler(logger *zap.Logger, bot *telego.Bot, service *service.TelegramChannelImpl) *WebhookHandler {
+// NewWebhookHandler creates the webhook handler. When secretToken is not
+// empty, requests without a matching SecretTokenHeader are rejected.
+func NewWebhookHandler(logger *zap.Logger, bot *telego.Bot, service *service.TelegramChannelImpl, secretToken string) *WebhookHandler {
 	return &WebhookHandler{
-		logger:  logger,
-		bot:     bot,
-		service: service,
+		logger:      logger,
+		bot:         bot,
+		service:     service,
+		secretToken: secretToken,
 	}
 }
 
+// UseQueue makes HandleWebhook acknowledge updates immediately and process
+// them on q. Without a queue updates are processed before responding, which
+// serverless deployments rely on.
+func (h *WebhookHandler) UseQueue(q *queue.Pool) {
+	h.queue = q
+}
+
 func (h *WebhookHandler) HandleWebhook(c *fiber.Ctx) error {
+	if !h.authorized(c) {
+		h.logger.Warn("rejected webhook request with invalid secret token", zap.String("ip", c.IP()))
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid secret token",
+		})
+	}
+
 	// Parse the update from the request body
 	var update telego.Update
 	if err := c.BodyParser(&update); err != nil {
@@ -32,23 +93,85 @@ func (h *WebhookHandler) HandleWebhook(c *fiber.Ctx) error {
 		})
 	}
 
-	// Handle the update based on its type
-	if update.Message != nil {
-		message := update.Message
-		h.logger.Info("received message",
-			zap.String("from", message.From.Username),
-			zap.String("text", message.Text))
-
-		// Handle text messages
-		if message.Text != "" {
-			h.logger.Info("processing text message", zap.String("text", message.Text))
-
-			// Process media from the text message using the service
-			if err := h.service.ProcessMedia(update); err != nil {
-				h.logger.Error("failed to process media", zap.Error(err))
-			}
+	metrics.UpdatesReceived.WithLabelValues(UpdateType(update)).Inc()
+
+	// Only text messages can carry links
+	if update.Message == nil || update.Message.Text == "" {
+		return c.SendStatus(200)
+	}
+
+	if h.queue == nil {
+		if err := h.Process(c.UserContext(), update); err != nil {
+			h.logger.Error("failed to process media", zap.Error(err))
 		}
+		return c.SendStatus(200)
+	}
+
+	// Acknowledge right away and let a worker process the update
+	switch err := h.queue.Submit(update); {
+	case err == nil:
+	case errors.Is(err, queue.ErrDropped):
+		h.logger.Warn("update dropped, queue is full", zap.Int("update_id", update.UpdateID))
+	default:
+		h.logger.Warn("update rejected, asking Telegram to redeliver", zap.Int("update_id", update.UpdateID), zap.Error(err))
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Queue is full",
+		})
 	}
 
 	return c.SendStatus(200)
 }
+
+// Process handles a single update synchronously. It is used directly when no
+// queue is configured and as the queue's worker function otherwise. It logs
+// the summary of the links handled and returns only the errors left out of
+// it, such as a failed command.
+func (h *WebhookHandler) Process(ctx context.Context, update telego.Update) error {
+	message := update.Message
+	if message == nil || message.Text == "" {
+		return nil
+	}
+
+	// Tag the line with the update and its correlation ID, which
+	// ProcessMedia keeps for everything it logs
+	ctx = logs.ForUpdate(ctx, h.logger, update.UpdateID, message.Chat.ID)
+
+	// User IDs and text are redacted by the logger unless debugging
+	fields := []zap.Field{zap.String(logs.TextKey, message.Text)}
+	if message.From != nil {
+		fields = append(fields, zap.Int64(logs.UserIDKey, message.From.ID))
+	}
+	logs.FromContext(ctx, h.logger).Info("received message", fields...)
+
+	// Process media from the text message using the service. Failed links
+	// are logged with the report, so its error is not returned to be logged
+	// again by the caller.
+	report, err := h.service.ProcessMedia(ctx, update)
+	if report != nil {
+		service.LogReport(h.logger, report)
+		return nil
+	}
+	return err
+}
+
+func (h *WebhookHandler) authorized(c *fiber.Ctx) bool {
+	if h.secretToken == "" {
+		return true
+	}
+	token := c.Get(SecretTokenHeader)
+	return subtle.ConstantTimeCompare([]byte(token), []byte(h.secretToken)) == 1
+}
+
+// UpdateType names the kind of update, for logs and metrics.
+func UpdateType(update telego.Update) string {
+	if update.Message != nil {
+		return "message"
+	}
+	if update.CallbackQuery != nil {
+		return "callback_query"
+	}
+	if update.InlineQuery != nil {
+		return "inline_query"
+	}
+	return "unknown"
+}
@@ -0,0 +1,456 @@
+package webhook_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"thumb-bot/config"
+	"thumb-bot/infra/httpclient"
+	"thumb-bot/infra/telegramtest"
+	"thumb-bot/service"
+	"thumb-bot/webhook"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mymmrac/telego"
+	"go.uber.org/zap/zaptest"
+)
+
+const (
+	secret  = "test-secret"
+	groupID = int64(-1001)
+	userID  = int64(42)
+)
+
+// harness runs the webhook handler against a fake Bot API server, with the
+// upstream requests of the integrations answered by upstream.
+type harness struct {
+	t        *testing.T
+	telegram *telegramtest.Server
+	upstream *upstream
+	app      *fiber.App
+	updateID int
+}
+
+func newHarness(t *testing.T) *harness {
+	t.Helper()
+
+	telegram := telegramtest.NewServer()
+	t.Cleanup(telegram.Close)
+	bot, err := telegram.NewBot()
+	if err != nil {
+		t.Fatalf("creating bot: %v", err)
+	}
+
+	cfg := config.Default()
+	cfg.TelegramToken = telegramtest.Token
+	cfg.Webhook.Secret = secret
+
+	logger := zaptest.NewLogger(t)
+	up := newUpstream()
+	clients, err := httpclient.NewFactory(logger, httpclient.Config{
+		Timeout:      5 * time.Second,
+		MaxBodyBytes: cfg.HTTPClient.MaxBodyBytes,
+		Transport:    up,
+	})
+	if err != nil {
+		t.Fatalf("creating http clients: %v", err)
+	}
+
+	svc := service.NewTelegramService(logger, bot, cfg, service.WithHTTPClients(clients))
+	handler := webhook.NewWebhookHandler(logger, bot, svc, secret)
+
+	app := fiber.New()
+	app.Post(webhook.Path, handler.HandleWebhook)
+
+	return &harness{t: t, telegram: telegram, upstream: up, app: app}
+}
+
+// post delivers update through the webhook endpoint with the given secret,
+// returning the response status.
+func (h *harness) post(update telego.Update, token string) int {
+	h.t.Helper()
+
+	body, err := json.Marshal(update)
+	if err != nil {
+		h.t.Fatalf("encoding update: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, webhook.Path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhook.SecretTokenHeader, token)
+
+	resp, err := h.app.Test(req, -1)
+	if err != nil {
+		h.t.Fatalf("posting update: %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+// send delivers a new message with text in chatID and expects it accepted.
+func (h *harness) send(chatID int64, text string) telego.Update {
+	h.t.Helper()
+
+	h.updateID++
+	update := telego.Update{
+		UpdateID: h.updateID,
+		Message: &telego.Message{
+			MessageID: 100 + h.updateID,
+			From:      &telego.User{ID: userID, FirstName: "Test"},
+			Chat:      telego.Chat{ID: chatID, Type: chatType(chatID)},
+			Date:      time.Now().Unix(),
+			Text:      text,
+		},
+	}
+	if status := h.post(update, secret); status != fiber.StatusOK {
+		h.t.Fatalf("webhook answered %d, want 200", status)
+	}
+	return update
+}
+
+// single returns the only call of method, failing the test otherwise.
+func (h *harness) single(method string) telegramtest.Call {
+	h.t.Helper()
+
+	calls := h.telegram.Calls(method)
+	if len(calls) != 1 {
+		h.t.Fatalf("got %d %s calls, want 1: %+v", len(calls), method, h.telegram.Calls())
+	}
+	return calls[0]
+}
+
+func chatType(chatID int64) string {
+	if chatID > 0 {
+		return telego.ChatTypePrivate
+	}
+	return telego.ChatTypeSupergroup
+}
+
+// upstream answers the requests of the integrations in-process, by host and
+// path, and counts them.
+type upstream struct {
+	mu     sync.Mutex
+	routes map[string]http.HandlerFunc
+	hits   map[string]int
+}
+
+func newUpstream() *upstream {
+	return &upstream{routes: make(map[string]http.HandlerFunc), hits: make(map[string]int)}
+}
+
+// handle routes requests for rawURL, ignoring its query, to fn.
+func (u *upstream) handle(rawURL string, fn http.HandlerFunc) {
+	req := httptest.NewRequest(http.MethodGet, rawURL, nil)
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.routes[req.URL.Host+req.URL.Path] = fn
+}
+
+// json answers requests for rawURL with status and body.
+func (u *upstream) json(rawURL string, status int, body string) {
+	u.handle(rawURL, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	})
+}
+
+func (u *upstream) count(rawURL string) int {
+	req := httptest.NewRequest(http.MethodGet, rawURL, nil)
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.hits[req.URL.Host+req.URL.Path]
+}
+
+func (u *upstream) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := req.URL.Host + req.URL.Path
+	u.mu.Lock()
+	fn, ok := u.routes[key]
+	u.hits[key]++
+	u.mu.Unlock()
+
+	rec := httptest.NewRecorder()
+	if ok {
+		fn(rec, req)
+	} else {
+		http.NotFound(rec, req)
+	}
+	resp := rec.Result()
+	resp.Request = req
+	return resp, nil
+}
+
+func fxTweet(id, text string, media string) string {
+	tweet := `{"code":200,"message":"OK","tweet":{"url":"https://x.com/jack/status/` + id + `","id":"` + id + `",` +
+		`"text":"` + text + `","author":{"name":"Jack","screen_name":"jack"},"likes":3,"retweets":1`
+	if media != "" {
+		tweet += `,"media":{"all":[` + media + `]}`
+	}
+	return tweet + `}}`
+}
+
+const (
+	photoA = `{"type":"photo","url":"https://pbs.twimg.com/media/a.jpg","width":800,"height":600}`
+	photoB = `{"type":"photo","url":"https://pbs.twimg.com/media/b.jpg","width":800,"height":600}`
+	video  = `{"type":"video","url":"https://video.twimg.com/v.mp4","thumbnail_url":"https://pbs.twimg.com/t.jpg",` +
+		`"duration":10,"variants":[{"content_type":"video/mp4","url":"https://video.twimg.com/v_720.mp4","bitrate":2176000},` +
+		`{"content_type":"video/mp4","url":"https://video.twimg.com/v_360.mp4","bitrate":632000}]}`
+)
+
+func TestPhotoTweetIsRepliedWithPhoto(t *testing.T) {
+	h := newHarness(t)
+	h.upstream.json("https://api.fxtwitter.com/jack/status/20", http.StatusOK, fxTweet("20", "just setting up", photoA))
+
+	update := h.send(groupID, "look https://x.com/jack/status/20")
+
+	call := h.single("sendPhoto")
+	if got := call.Int("chat_id"); got != groupID {
+		t.Errorf("chat_id = %d, want %d", got, groupID)
+	}
+	if got := call.Params["photo"]; got != "https://pbs.twimg.com/media/a.jpg" {
+		t.Errorf("photo = %q", got)
+	}
+	if got := call.Int("reply_to_message_id"); got != int64(update.Message.MessageID) {
+		t.Errorf("reply_to_message_id = %d, want %d", got, update.Message.MessageID)
+	}
+	caption := call.Params["caption"]
+	for _, want := range []string{"https://x.com/jack/status/20", "jack: just setting up", "💟 3 🔁 1"} {
+		if !strings.Contains(caption, want) {
+			t.Errorf("caption %q does not contain %q", caption, want)
+		}
+	}
+}
+
+func TestTweetWithSeveralMediaIsRepliedWithAlbum(t *testing.T) {
+	h := newHarness(t)
+	h.upstream.json("https://api.fxtwitter.com/jack/status/21", http.StatusOK, fxTweet("21", "album", photoA+","+photoB+","+video))
+
+	h.send(groupID, "https://twitter.com/jack/status/21")
+
+	media, err := h.single("sendMediaGroup").Media()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []telegramtest.Media{
+		{Type: "photo", Media: "https://pbs.twimg.com/media/a.jpg"},
+		{Type: "photo", Media: "https://pbs.twimg.com/media/b.jpg"},
+		{Type: "video", Media: "https://video.twimg.com/v_720.mp4"},
+	}
+	if len(media) != len(want) {
+		t.Fatalf("got %d media, want %d: %+v", len(media), len(want), media)
+	}
+	for i := range want {
+		if media[i].Type != want[i].Type || media[i].Media != want[i].Media {
+			t.Errorf("media[%d] = %s %s, want %s %s", i, media[i].Type, media[i].Media, want[i].Type, want[i].Media)
+		}
+		if hasCaption := media[i].Caption != ""; hasCaption != (i == 0) {
+			t.Errorf("media[%d] caption = %q, want one on the first item only", i, media[i].Caption)
+		}
+	}
+}
+
+func TestTextOnlyTweetIsRepliedWithMessage(t *testing.T) {
+	h := newHarness(t)
+	h.upstream.json("https://api.fxtwitter.com/jack/status/22", http.StatusOK, fxTweet("22", "no media here", ""))
+
+	h.send(groupID, "https://x.com/jack/status/22")
+
+	text := h.single("sendMessage").Params["text"]
+	if !strings.Contains(text, "jack: no media here") {
+		t.Errorf("text = %q", text)
+	}
+	if calls := h.telegram.Calls("sendPhoto", "sendVideo", "sendMediaGroup"); len(calls) != 0 {
+		t.Errorf("unexpected media calls: %+v", calls)
+	}
+}
+
+func TestInvalidSecretIsRejected(t *testing.T) {
+	h := newHarness(t)
+	h.upstream.json("https://api.fxtwitter.com/jack/status/20", http.StatusOK, fxTweet("20", "hi", photoA))
+
+	update := telego.Update{
+		UpdateID: 1,
+		Message: &telego.Message{
+			MessageID: 1,
+			Chat:      telego.Chat{ID: groupID, Type: telego.ChatTypeSupergroup},
+			Text:      "https://x.com/jack/status/20",
+		},
+	}
+	if status := h.post(update, "wrong"); status != fiber.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", status)
+	}
+	if calls := h.telegram.Calls(); len(calls) != 0 {
+		t.Errorf("unexpected calls: %+v", calls)
+	}
+}
+
+func TestRedeliveredUpdateIsHandledOnce(t *testing.T) {
+	h := newHarness(t)
+	h.upstream.json("https://api.fxtwitter.com/jack/status/20", http.StatusOK, fxTweet("20", "hi", photoA))
+
+	update := h.send(groupID, "https://x.com/jack/status/20")
+	if status := h.post(update, secret); status != fiber.StatusOK {
+		t.Fatalf("status = %d, want 200", status)
+	}
+
+	h.single("sendPhoto")
+}
+
+func TestRepostedLinkIsResentByFileID(t *testing.T) {
+	h := newHarness(t)
+	h.upstream.json("https://api.fxtwitter.com/jack/status/20", http.StatusOK, fxTweet("20", "hi", photoA))
+
+	h.send(groupID, "https://x.com/jack/status/20")
+	h.send(groupID, "again https://twitter.com/jack/status/20?s=20")
+
+	calls := h.telegram.Calls("sendPhoto")
+	if len(calls) != 2 {
+		t.Fatalf("got %d sendPhoto calls, want 2", len(calls))
+	}
+	if got := calls[1].Params["photo"]; got != "photo-1" {
+		t.Errorf("second photo = %q, want the file_id of the first", got)
+	}
+	if got := h.upstream.count("https://api.fxtwitter.com/jack/status/20"); got != 1 {
+		t.Errorf("fxtwitter was called %d times, want 1", got)
+	}
+}
+
+func TestFailedLinkDoesNotStopTheOthers(t *testing.T) {
+	h := newHarness(t)
+	h.upstream.json("https://api.fxtwitter.com/jack/status/404", http.StatusOK, `{"code":404,"message":"NOT_FOUND"}`)
+	h.upstream.json("https://api.vxtwitter.com/jack/status/404", http.StatusNotFound, `{}`)
+	h.upstream.json("https://api.fxtwitter.com/jack/status/20", http.StatusOK, fxTweet("20", "hi", photoA))
+
+	h.send(groupID, "https://x.com/jack/status/404 https://x.com/jack/status/20")
+
+	h.single("sendPhoto")
+	if calls := h.telegram.Calls("sendMessage"); len(calls) != 0 {
+		t.Errorf("error replies are off by default, got %+v", calls)
+	}
+}
+
+func TestErrorRepliesExplainFailures(t *testing.T) {
+	h := newHarness(t)
+	h.upstream.json("https://api.fxtwitter.com/jack/status/403", http.StatusOK, `{"code":401,"message":"PRIVATE_TWEET"}`)
+	h.upstream.json("https://api.vxtwitter.com/jack/status/403", http.StatusUnauthorized, `{}`)
+
+	h.send(userID, "/settings errors on")
+	if text := h.single("sendMessage").Params["text"]; !strings.Contains(text, "errors: on") {
+		t.Fatalf("settings reply = %q", text)
+	}
+	h.telegram.Reset()
+
+	h.send(userID, "https://x.com/jack/status/403")
+
+	if text := h.single("sendMessage").Params["text"]; text != "Couldn't post that link: the post is private." {
+		t.Errorf("error reply = %q", text)
+	}
+}
+
+func TestSettingsNeedChatAdmin(t *testing.T) {
+	h := newHarness(t)
+
+	h.send(groupID, "/settings caption link")
+	if text := h.single("sendMessage").Params["text"]; !strings.Contains(text, "Only chat administrators") {
+		t.Fatalf("reply to member = %q", text)
+	}
+	h.telegram.Reset()
+
+	h.telegram.AddAdmin(userID)
+	h.send(groupID, "/settings caption link")
+	if text := h.single("sendMessage").Params["text"]; !strings.Contains(text, "caption: link") {
+		t.Errorf("reply to admin = %q", text)
+	}
+}
+
+func TestMediaTelegramCannotFetchIsUploaded(t *testing.T) {
+	h := newHarness(t)
+	h.upstream.json("https://api.fxtwitter.com/jack/status/20", http.StatusOK, fxTweet("20", "hi", photoA))
+	h.upstream.handle("https://pbs.twimg.com/media/a.jpg", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write([]byte("jpeg bytes"))
+	})
+	h.telegram.Fail("sendPhoto", "Bad Request: failed to get HTTP URL content")
+
+	h.send(groupID, "https://x.com/jack/status/20")
+
+	calls := h.telegram.Calls("sendPhoto")
+	if len(calls) != 2 {
+		t.Fatalf("got %d sendPhoto calls, want the URL then the upload", len(calls))
+	}
+	file, ok := calls[1].Files["photo"]
+	if !ok {
+		t.Fatalf("second sendPhoto uploaded no file: %+v", calls[1])
+	}
+	if string(file.Data) != "jpeg bytes" {
+		t.Errorf("uploaded %q", file.Data)
+	}
+}
+
+func TestLinkVariantsOfOnePostArePostedOnce(t *testing.T) {
+	h := newHarness(t)
+	h.upstream.json("https://api.fxtwitter.com/jack/status/20", http.StatusOK, fxTweet("20", "hi", photoA))
+
+	h.send(groupID, "https://x.com/jack/status/20 and https://twitter.com/jack/status/20?s=20")
+
+	h.single("sendPhoto")
+}
+
+func TestMediaOverTheSizeLimitIsExplained(t *testing.T) {
+	h := newHarness(t)
+	h.upstream.json("https://api.fxtwitter.com/jack/status/20", http.StatusOK, fxTweet("20", "hi", photoA))
+	h.upstream.handle("https://pbs.twimg.com/media/a.jpg", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Header().Set("Content-Length", "1099511627776")
+	})
+	h.telegram.Fail("sendPhoto", "Bad Request: failed to get HTTP URL content")
+
+	h.send(userID, "/settings errors on")
+	h.telegram.Reset()
+
+	h.send(userID, "https://x.com/jack/status/20")
+
+	if text := h.single("sendMessage").Params["text"]; text != "Couldn't post that link: the media is too large to send." {
+		t.Errorf("error reply = %q", text)
+	}
+}
+
+func TestVocarooRecordingOverTheSizeLimitIsExplained(t *testing.T) {
+	h := newHarness(t)
+	h.upstream.handle("https://media1.vocaroo.com/mp3/1abcDEF", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Header().Set("Content-Length", "1099511627776")
+	})
+
+	h.send(userID, "/settings errors on")
+	h.telegram.Reset()
+
+	h.send(userID, "https://voca.ro/1abcDEF")
+
+	if text := h.single("sendMessage").Params["text"]; text != "This Vocaroo recording is too large to upload." {
+		t.Errorf("notice = %q", text)
+	}
+}
+
+func TestLinksOfMediaTurnedOffAreIgnored(t *testing.T) {
+	h := newHarness(t)
+	h.upstream.json("https://api.fxtwitter.com/jack/status/20", http.StatusOK, fxTweet("20", "hi", photoA))
+
+	h.send(userID, "/settings media audio off")
+	if text := h.single("sendMessage").Params["text"]; !strings.Contains(text, "audio: off") {
+		t.Fatalf("settings reply = %q", text)
+	}
+	h.telegram.Reset()
+
+	h.send(userID, "https://voca.ro/1abcDEF https://x.com/jack/status/20")
+
+	h.single("sendPhoto")
+	if n := h.upstream.count("https://media1.vocaroo.com/mp3/1abcDEF"); n != 0 {
+		t.Errorf("fetched the recording %d times with audio off", n)
+	}
+}